@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// loadConfigFile applies the settings in the file at path to the flags of
+// fs, except those given on the command line, which take precedence.
+// Settings are named after the flags, e.g. {"device": "USB", "channels": 2}.
+// Files ending in .yaml or .yml hold flat "name: value" lines instead of a
+// JSON object.
+func loadConfigFile(path string, fs *flag.FlagSet) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var settings map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		settings, err = parseFlatYAML(data)
+	default:
+		settings, err = parseJSONSettings(data)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	onCommandLine := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { onCommandLine[f.Name] = true })
+	for name, value := range settings {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+		if onCommandLine[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: invalid %s %q: %w", path, name, value, err)
+		}
+	}
+	return nil
+}
+
+// parseJSONSettings reads a JSON object of strings, numbers and booleans.
+func parseJSONSettings(data []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	settings := make(map[string]string, len(raw))
+	for name, v := range raw {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			settings[name] = s
+			continue
+		}
+		v = bytes.TrimSpace(v)
+		if len(v) == 0 || v[0] == '{' || v[0] == '[' || string(v) == "null" {
+			return nil, fmt.Errorf("setting %q must be a string, number or boolean", name)
+		}
+		settings[name] = string(v)
+	}
+	return settings, nil
+}
+
+// parseFlatYAML reads "name: value" lines, ignoring blank lines and #
+// comments. Values may be quoted. Nested mappings and lists are not
+// supported.
+func parseFlatYAML(data []byte) (map[string]string, error) {
+	settings := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected name: value", line)
+		}
+		value = strings.TrimSpace(value)
+		if q, err := strconv.Unquote(value); err == nil {
+			value = q
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		} else if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		settings[strings.TrimSpace(name)] = value
+	}
+	return settings, sc.Err()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"audio-grab/recorder"
+)
+
+const (
+	// volumeStepDB is the gain change applied per + or - keypress.
+	volumeStepDB = 1.0
+
+	meterInterval = 100 * time.Millisecond
+	meterWidth    = 40
+	meterFloorDB  = -60.0
+)
+
+// keyActions maps keys to what they do besides the built-in ones.
+type keyActions map[byte]func()
+
+// adjustVolume reads + and - keypresses from in and raises or lowers the
+// gain of the recorders by volumeStepDB for each; m drops a marker at the
+// current position, and other keys run their entry in actions, if any.
+// Unless the terminal is in raw mode, keypresses are delivered once Enter is
+// pressed.
+func adjustVolume(in io.Reader, actions keyActions, rs ...*recorder.Recorder) {
+	br := bufio.NewReader(in)
+	markers := 0
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return
+		}
+
+		var step float64
+		switch c {
+		case '+', '=':
+			step = volumeStepDB
+		case '-', '_':
+			step = -volumeStepDB
+		case 'm', 'M':
+			markers++
+			for _, r := range rs {
+				r.AddMarker(fmt.Sprintf("Marker %d", markers))
+			}
+			continue
+		default:
+			if fn := actions[c]; fn != nil {
+				fn()
+			}
+			continue
+		}
+
+		for _, r := range rs {
+			v := r.Volume() * math.Pow(10, step/20)
+			r.SetVolume(v)
+			slog.Info("Gain changed", "dB", math.Round(200*math.Log10(v))/10)
+		}
+	}
+}
+
+// showLevels redraws a peak/RMS meter line on w every meterInterval until ctx
+// is done. Multi-channel input gets one line per channel, redrawn in place
+// with ANSI cursor movement.
+func showLevels(ctx context.Context, r *recorder.Recorder, w io.Writer) {
+	ticker := time.NewTicker(meterInterval)
+	defer ticker.Stop()
+	drawn := 0
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(w)
+			return
+		case <-ticker.C:
+			status := ""
+			if left := r.Countdown(); left > 0 {
+				status = fmt.Sprintf("ready in %ds", int(math.Ceil(left.Seconds())))
+			}
+			levels := r.ChannelLevels()
+			if len(levels) == 1 {
+				l := r.Level()
+				fmt.Fprintf(w, "\r[%-*s] peak %6.1f dBFS  rms %6.1f dBFS  %-12s", meterWidth, meterBar(l.RMS), l.Peak, l.RMS, status)
+				continue
+			}
+			if drawn > 1 {
+				fmt.Fprintf(w, "\x1b[%dA", drawn-1)
+			}
+			for c, l := range levels {
+				if c > 0 {
+					fmt.Fprintln(w)
+				}
+				fmt.Fprintf(w, "\r%2d [%-*s] peak %6.1f dBFS  rms %6.1f dBFS", c+1, meterWidth, meterBar(l.RMS), l.Peak, l.RMS)
+			}
+			fmt.Fprintf(w, "  %-12s", status)
+			drawn = len(levels)
+		}
+	}
+}
+
+// showStats prints a status line to w every interval until ctx is done: the
+// audio captured, the sample data written, the level of the last buffer and
+// the overflows so far. Unlike showLevels it never redraws, which suits log
+// files.
+func showStats(ctx context.Context, r *recorder.Recorder, w io.Writer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			elapsed := time.Duration(float64(r.FramesCaptured()) / r.SampleRate() * float64(time.Second))
+			l := r.Level()
+			fmt.Fprintf(w, "%v  %.1f MB  peak %.1f dBFS  rms %.1f dBFS  overflows %d\n",
+				elapsed.Truncate(time.Second), float64(r.BytesWritten())/1e6, l.Peak, l.RMS, r.Overflows())
+		}
+	}
+}
+
+// meterBar renders db as a bar scaled between meterFloorDB and 0 dBFS.
+func meterBar(db float64) string {
+	n := int((db - meterFloorDB) / -meterFloorDB * meterWidth)
+	n = max(0, min(meterWidth, n))
+	return strings.Repeat("#", n)
+}
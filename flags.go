@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"audio-grab/recorder"
+)
+
+// byteSize is a flag value holding a number of bytes, optionally with a
+// decimal (kB, MB, GB) or binary (KiB, MiB, GiB) unit.
+type byteSize int64
+
+func (s *byteSize) String() string { return strconv.FormatInt(int64(*s), 10) }
+
+func (s *byteSize) Set(v string) error {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+		{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+		{"B", 1},
+	}
+	scale := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(v, u.suffix) {
+			v, scale = strings.TrimSpace(strings.TrimSuffix(v, u.suffix)), u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", v)
+	}
+	*s = byteSize(n * float64(scale))
+	return nil
+}
+
+// channelCount is a flag value holding a channel count, or "auto" or "all"
+// for recorder.AllChannels.
+type channelCount int
+
+func (c *channelCount) String() string {
+	if *c == recorder.AllChannels {
+		return "auto"
+	}
+	return strconv.Itoa(int(*c))
+}
+
+func (c *channelCount) Set(v string) error {
+	if v == "auto" || v == "all" {
+		*c = recorder.AllChannels
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return fmt.Errorf("invalid channel count %q", v)
+	}
+	*c = channelCount(n)
+	return nil
+}
+
+// filterList collects the values of a repeated -eq flag, each of the form
+// type:freq[:gain[:Q]].
+type filterList []recorder.Filter
+
+func (l *filterList) String() string {
+	var s []string
+	for _, f := range *l {
+		s = append(s, fmt.Sprintf("%s:%g:%g:%g", f.Type, f.Freq, f.GainDB, f.Q))
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *filterList) Set(v string) error {
+	fields := strings.Split(v, ":")
+	if len(fields) < 2 || len(fields) > 4 {
+		return fmt.Errorf("invalid filter %q, want type:freq[:gain[:Q]]", v)
+	}
+	f := recorder.Filter{Type: recorder.FilterType(fields[0])}
+	for i, p := range []*float64{&f.Freq, &f.GainDB, &f.Q}[:len(fields)-1] {
+		n, err := strconv.ParseFloat(fields[i+1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid filter %q: %w", v, err)
+		}
+		*p = n
+	}
+	*l = append(*l, f)
+	return nil
+}
+
+// channelList collects the values of a channel-number flag such as
+// -invert-channel or -map, given repeatedly or as a comma-separated list.
+type channelList []int
+
+func (l *channelList) String() string {
+	var s []string
+	for _, ch := range *l {
+		s = append(s, strconv.Itoa(ch))
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *channelList) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		ch, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || ch < 0 {
+			return fmt.Errorf("invalid channel %q", s)
+		}
+		*l = append(*l, ch)
+	}
+	return nil
+}
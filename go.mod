@@ -2,12 +2,4 @@ module audio-grab
 
 go 1.24.0
 
-require (
-	github.com/gopxl/beep/v2 v2.1.1 // indirect
-	github.com/gordonklaus/portaudio v0.0.0-20250206071425-98a94950218b // indirect
-	github.com/hajimehoshi/go-mp3 v0.3.4 // indirect
-	github.com/icza/bitio v1.1.0 // indirect
-	github.com/mewkiz/flac v1.0.12 // indirect
-	github.com/mewkiz/pkg v0.0.0-20230226050401-4010bf0fec14 // indirect
-	github.com/pkg/errors v0.9.1 // indirect
-)
+require github.com/gordonklaus/portaudio v0.0.0-20250206071425-98a94950218b
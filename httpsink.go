@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"audio-grab/recorder"
+)
+
+const (
+	// httpSinkBuffers is the stream queue used while a sink is attached, so
+	// that a few seconds of audio survive a reconnect.
+	httpSinkBuffers = 1024
+
+	httpSinkAttempts   = 5
+	httpSinkMinBackoff = 500 * time.Millisecond
+	httpSinkMaxBackoff = 8 * time.Second
+	httpSinkReadSize   = 64 << 10
+)
+
+type httpStatusError struct {
+	status string
+	code   int
+}
+
+func (e *httpStatusError) Error() string { return "server replied " + e.status }
+
+// transient reports whether a failed upload is worth retrying: network
+// errors, timeouts and server-side failures are, other client errors are not.
+func transient(err error) bool {
+	var se *httpStatusError
+	if !errors.As(err, &se) {
+		return true
+	}
+	return se.code >= 500 || se.code == http.StatusTooManyRequests || se.code == http.StatusRequestTimeout
+}
+
+// httpSink uploads the live audio of a Recorder as the chunked body of a POST
+// request. A failed request is retried with exponential backoff, resuming
+// from the audio captured since; every new request starts with a fresh WAV
+// header if wav is set.
+type httpSink struct {
+	url     string
+	wav     bool
+	info    recorder.StreamInfo
+	stream  io.ReadCloser
+	buf     []byte
+	pending []byte // Read from stream but not yet accepted by a request.
+	eof     bool
+	done    chan struct{}
+	err     error
+}
+
+func startHTTPSink(url string, r *recorder.Recorder, wav bool) (*httpSink, error) {
+	if _, err := http.NewRequest(http.MethodPost, url, nil); err != nil {
+		return nil, err
+	}
+	info := r.StreamInfo()
+	if wav {
+		if err := recorder.WriteStreamHeader(io.Discard, info); err != nil {
+			return nil, err
+		}
+	}
+	s := &httpSink{
+		url:    url,
+		wav:    wav,
+		info:   info,
+		stream: r.Stream(),
+		buf:    make([]byte, httpSinkReadSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Wait blocks until the upload has ended, which happens once the Recorder is
+// stopped and the server has answered the final request, and returns the
+// error that ended it, if any.
+func (s *httpSink) Wait() error {
+	<-s.done
+	return s.err
+}
+
+func (s *httpSink) run() {
+	defer close(s.done)
+	defer s.stream.Close()
+
+	backoff := httpSinkMinBackoff
+	for attempt := 1; ; attempt++ {
+		sent, err := s.post()
+		if err == nil {
+			return
+		}
+		if sent {
+			attempt, backoff = 0, httpSinkMinBackoff
+		}
+		if !transient(err) || attempt == httpSinkAttempts || (s.eof && len(s.pending) == 0) {
+			s.err = err
+			return
+		}
+		slog.Warn("HTTP sink failed; retrying", "err", err, "backoff", backoff)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, httpSinkMaxBackoff)
+	}
+}
+
+// post sends a single request whose body is fed from the stream until it
+// ends. It reports whether any audio was accepted by the request.
+func (s *httpSink) post() (bool, error) {
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, s.url, pr)
+	if err != nil {
+		return false, err
+	}
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if s.wav {
+		req.Header.Set("Content-Type", "audio/wav")
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				err = &httpStatusError{resp.Status, resp.StatusCode}
+			}
+		}
+		// Unblocks the writes below if the server answered early.
+		pr.CloseWithError(io.ErrClosedPipe)
+		result <- err
+	}()
+
+	sent := false
+	if s.wav {
+		// Only fails once the request has ended.
+		if err := recorder.WriteStreamHeader(pw, s.info); err != nil {
+			return false, <-result
+		}
+	}
+	for {
+		if len(s.pending) == 0 {
+			if s.eof {
+				pw.Close()
+				break
+			}
+			n, err := s.stream.Read(s.buf)
+			s.pending = s.buf[:n]
+			if err != nil {
+				s.eof = true
+			}
+			continue
+		}
+		if _, err := pw.Write(s.pending); err != nil {
+			break
+		}
+		s.pending = nil
+		sent = true
+	}
+	return sent, <-result
+}
@@ -1,168 +1,612 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"math"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/gopxl/beep/v2"
-	"github.com/gopxl/beep/v2/wav"
-	"github.com/gordonklaus/portaudio"
+	"audio-grab/recorder"
 )
 
-const (
-	framesPerBuf = 512
-	channels     = 1 // Set to 2 for stereo
-	deviceIndex  = 4
-	volume       = 2.0
-)
-
-var possibleSampleRates = []float64{44100, 48000, 96000, 16000, 32000, 22050}
-
 func main() {
-	if err := portaudio.Initialize(); err != nil {
-		log.Fatal(err)
+	var devices deviceList
+	flag.Var(&devices, "device", "input device `index or name` substring, or the output device with -play or -loopback (default: system default); repeat to record several devices")
+	hostAPI := flag.String("hostapi", "", "find -device and -monitor-device among the devices of this host `API`, e.g. WASAPI, ASIO, CoreAudio or ALSA; -list-devices shows them (default: the system's default host API)")
+	loopback := flag.Bool("loopback", false, "record what plays on the output -device (default: system default output) instead of an input, where the host API offers loopback capture, e.g. WASAPI on Windows")
+	source := flag.String("source", "", "record a generated `signal` instead of a device: tone:FREQ or sweep:LOW:HIGH in Hz; needs -duration")
+	channels := channelCount(1)
+	flag.Var(&channels, "channels", "number of input channels to capture, or auto for all the device has")
+	downmix := flag.String("downmix", "stereo", "fold inputs with more than two channels to `mono or stereo`")
+	downmixMode := flag.String("downmix-mode", "average", "how channels folded together by -downmix or -mix mono-mix combine: average, sum (clamped) or sum-3db")
+	planar := flag.Bool("planar", false, "write every channel to a mono WAV file of its own, e.g. out.ch0.wav and out.ch1.wav for -out out.wav, instead of folding them")
+	var channelMap channelList
+	flag.Var(&channelMap, "map", "write only the input `channels` listed, counting from 0, in that order, e.g. 2,4; without -channels as many are captured as the highest needs")
+	mix := flag.String("mix", "", "output channels: mono-left, mono-right, mono-mix or stereo (default: as captured, folded per -downmix)")
+	volume := flag.Float64("volume", 2.0, "linear gain applied to every sample; adjust live with + and -")
+	channelMask := flag.Uint("channel-mask", 0, "WAVE_FORMAT_EXTENSIBLE speaker `mask` of WAV output, e.g. 0x3 for front left and right; 24- and 32-bit or multichannel WAV files get a default one")
+	gainDB := flag.Float64("gain-db", 0, "gain in `dB` applied on top of -volume, e.g. -6 halves and +6 doubles the amplitude (within ±96)")
+	bits := flag.Int("bits", 16, "PCM bits per sample (16, 24 or 32)")
+	dither := flag.String("dither", "none", "noise added when samples lose bits, as 24-bit output and scaled or processed 16-bit output do: tpdf, shaped (tpdf with noise shaping) or none")
+	floatSamples := flag.Bool("float", false, "write 32-bit IEEE float samples instead of integer PCM")
+	prebuffer := flag.Duration("prebuffer", 0, "discard this much audio each time the stream starts, as some devices deliver garbage at first; delays the start by as much")
+	countdown := flag.Int("countdown", 0, "show input levels for this many `seconds` before recording starts")
+	duration := flag.Duration("duration", 0, "stop after this much audio has been captured (0 records until interrupted)")
+	maxDuration := flag.Duration("max-duration", 0, "safety cap: stop with a warning after this much audio even if -duration is longer or unset (0 disables)")
+	out := flag.String("out", "micdropper.wav", "output `path`, or - for stdout; %Y, %m, %d, %H, %M and %S expand to the start time, %% is a literal %")
+	format := flag.String("format", "", "output `format`: wav, wav64, raw, aiff, flac, mp3, opus, alaw, ulaw or adpcm (default: from the -out extension, wav for stdout); wav64 becomes RF64 past 4 GiB of data")
+	bitrate := flag.Int("bitrate", 0, "bitrate of lossy formats in `kbps` (default 128 for mp3, 24 for opus)")
+	endian := flag.String("endian", "little", "sample byte order of raw output: little or big")
+	opusApplication := flag.String("opus-application", "voip", "opus tuning: voip or audio")
+	title := flag.String("title", "", "title stored in the WAV metadata")
+	artist := flag.String("artist", "", "artist stored in the WAV metadata")
+	comment := flag.String("comment", "", "comment stored in the WAV metadata")
+	bwf := flag.Bool("bwf", false, "write Broadcast Wave (bext) metadata with the recording's start time")
+	replayBuffer := flag.Duration("replay-buffer", 0, "keep only the last `duration` of audio in memory and save it to a timestamped file named after -out whenever s is pressed")
+	split := flag.Duration("split", 0, "start a new, timestamped output file after each such `duration` (0 writes a single file)")
+	var maxSize byteSize
+	flag.Var(&maxSize, "max-size", "start a new, numbered output file before one exceeds this `size`, e.g. 1GiB or 500MB (0 disables)")
+	reconnect := flag.Bool("reconnect", false, "if the input device is lost, wait for it to come back, under any index, and continue into the same file")
+	reconnectTimeout := flag.Duration("reconnect-timeout", 0, "with -reconnect, finish the recording if the device has not come back after this long (0 waits indefinitely)")
+	appendOut := flag.Bool("append", false, "continue an existing WAV output file of the same format instead of failing")
+	minFree := byteSize(64 << 20)
+	flag.Var(&minFree, "min-free", "refuse to start, or stop, when less than this `size` would be left free on the output's disk (0 disables the margin)")
+	force := flag.Bool("force", false, "overwrite the output file if it exists")
+	ratePolicy := flag.String("rate-policy", "first", "how to pick the sample rate: first, highest, lowest or nearest to the device default")
+	sampleRate := flag.Float64("sample-rate", 0, "capture sample rate in `Hz`, falling back to -rate-policy if the device cannot capture at it (default: chosen by -rate-policy)")
+	frames := flag.Int("frames", 512, "frames read from the device per buffer")
+	latency := flag.String("latency", "low", "suggested device latency: low, high or a `duration` such as 20ms")
+	resample := flag.Float64("resample", 0, "output sample rate in `Hz`, resampling if the device cannot capture at it")
+	silenceTimeout := flag.Duration("silence-timeout", 0, "stop after this much continuous silence once sound was heard (0 disables)")
+	silenceThreshold := flag.Float64("silence-threshold", -50, "level in `dBFS` below which audio counts as silence: the RMS of a buffer for -silence-timeout and -vad, the peak of a sample for -trim")
+	dcBlock := flag.Bool("dc-block", false, "remove DC offset with a high-pass filter")
+	dcBlockCutoff := flag.Float64("dc-block-cutoff", 20, "DC block filter cutoff in `Hz`")
+	invert := flag.Bool("invert", false, "flip the polarity of every input channel")
+	var invertChannels channelList
+	flag.Var(&invertChannels, "invert-channel", "flip the polarity of input channel `N`, counting from 0; repeat for several")
+	var eq filterList
+	flag.Var(&eq, "eq", "add a `type:freq[:gain[:Q]]` filter, type being lowpass, highpass, peaking, lowshelf or highshelf; repeat to chain filters")
+	gateOpen := flag.Float64("gate-open", 0, "noise gate open threshold in `dBFS` (0 disables the gate)")
+	gateClose := flag.Float64("gate-close", -60, "noise gate close threshold in `dBFS`")
+	gateAttack := flag.Float64("gate-attack", 1, "noise gate attack time in `ms`")
+	gateRelease := flag.Float64("gate-release", 50, "noise gate release time in `ms`")
+	limitThreshold := flag.Float64("limit-threshold", 0, "limit peaks after -volume to this level in `dBFS` instead of clipping (0 disables the limiter)")
+	limitRelease := flag.Float64("limit-release", 100, "limiter release time in `ms`")
+	vad := flag.Bool("vad", false, "only write audio above -silence-threshold, with pre- and post-roll")
+	vadPreRoll := flag.Duration("vad-preroll", 300*time.Millisecond, "audio kept before voice is detected in -vad mode")
+	vadPostRoll := flag.Duration("vad-postroll", 300*time.Millisecond, "audio kept after voice stops in -vad mode")
+	metricsAddr := flag.String("metrics-addr", "", "serve Prometheus metrics at /metrics on this `address`, e.g. :9100")
+	wsAddr := flag.String("ws-addr", "", "serve the live audio to WebSocket clients on this `address`, e.g. :8080")
+	httpSinkURL := flag.String("http-sink", "", "upload the live audio as a chunked POST to this `URL`")
+	httpSinkWAV := flag.Bool("http-sink-wav", false, "prefix the -http-sink upload with a WAV header instead of sending bare PCM")
+	monitor := flag.Bool("monitor", false, "play the input on an output device while recording")
+	monitorDevice := flag.String("monitor-device", "", "output device `index or name` substring for -monitor (default: system default output)")
+	normalize := flag.Bool("normalize", false, "rescale the finished file so its peak reaches -normalize-target; needs a seekable output")
+	normalizeTarget := flag.Float64("normalize-target", -1, "peak level in `dBFS` for -normalize")
+	trim := flag.Bool("trim", false, "cut leading and trailing audio below -silence-threshold from the finished file; needs a seekable output")
+	trimMargin := flag.Duration("trim-margin", 100*time.Millisecond, "audio kept before the first and after the last sound with -trim")
+	summary := flag.Bool("summary", false, "print a JSON summary of the recording to stderr when it ends")
+	sidecar := flag.Bool("sidecar", false, "write a JSON description of the recording next to the output, with its extension replaced by .json")
+	summaryFile := flag.String("summary-file", "", "write a JSON summary of the recording to this `file` when it ends")
+	timestampPath := flag.String("timestamp", "", "log the wall-clock time of a captured frame every second to this `file`, as JSON lines if it ends in .json or .jsonl, CSV otherwise, to align recordings")
+	verbose := flag.Bool("verbose", false, "log stream latency, clock and the gaps between reads, to debug dropouts")
+	quiet := flag.Bool("quiet", false, "do not show the input level meter")
+	statsInterval := flag.Duration("stats-interval", 0, "print the elapsed time, bytes written, level and overflows to stderr as one line per `interval`, e.g. with -quiet for log files (0 disables)")
+	repair := flag.String("repair", "", "fix the size fields of the WAV `file` after an interrupted recording and exit")
+	play := flag.String("play", "", "play the WAV `file` and exit")
+	wrap := flag.String("wrap", "", "write the headerless PCM `file`, and any further arguments, as WAV files laid out per -sample-rate, -channels, -bits and -float, then exit; -out names the result of a single file, otherwise the extension is replaced by .wav")
+	compare := flag.String("compare", "", "compare the sample data of the WAV `file` with that of the WAV file given as the argument, print where they differ and exit, with status 1 if they do")
+	tolerance := flag.Float64("tolerance", 0, "largest sample difference, as a `fraction` of full scale, that -compare ignores, e.g. 0.001 after a lossy round trip")
+	configPath := flag.String("config", "", "read settings from a JSON or YAML `file`; command-line flags take precedence")
+	check := flag.Bool("check", false, "validate the device, sample rate and output, print what would be recorded and exit")
+	logLevel := flag.String("log-level", "info", "minimum level of log messages: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "log message format: text or json")
+	listDevices := flag.Bool("list-devices", false, "print device capabilities and exit")
+	flag.Parse()
+
+	if *configPath != "" {
+		if err := loadConfigFile(*configPath, flag.CommandLine); err != nil {
+			fatalf("%v", err)
+		}
 	}
-	defer portaudio.Terminate()
 
-	devices, err := portaudio.Devices()
-	if err != nil {
-		log.Fatal(err)
+	if err := setupLogging(*logLevel, *logFormat); err != nil {
+		fatalf("%v", err)
 	}
 
-	for i, dev := range devices {
-		if dev.MaxInputChannels >= channels {
-			log.Printf("Device #%d: %s", i, dev.Name)
+	if *listDevices {
+		if err := recorder.ListDevices(os.Stdout); err != nil {
+			fatalf("%v", err)
 		}
+		return
 	}
 
-	device := devices[deviceIndex]
+	if *repair != "" {
+		fixed, err := recorder.RepairWav(*repair)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		if fixed {
+			fmt.Printf("Repaired the header of %s\n", *repair)
+		} else {
+			fmt.Printf("The header of %s is already consistent\n", *repair)
+		}
+		return
+	}
 
-	sampleRate, err := findWorkingSampleRate(device)
-	if err != nil {
-		log.Fatalf("No working sample rate found: %v", err)
+	if *wrap != "" {
+		wrapRaw(append([]string{*wrap}, flag.Args()...), recorder.StreamInfo{
+			SampleRate:    int(*sampleRate),
+			Channels:      int(channels),
+			BitsPerSample: *bits,
+			Float:         *floatSamples,
+			BigEndian:     *endian == "big",
+		}, *out, *force)
+		return
+	}
+	if *compare != "" {
+		compareWav(*compare, flag.Args(), *tolerance)
+		return
+	}
+	if flag.NArg() > 0 {
+		fatalf("unexpected arguments %q", flag.Args())
 	}
 
-	buffer := make([]int16, framesPerBuf*channels)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	params := portaudio.StreamParameters{
-		Input: portaudio.StreamDeviceParameters{
-			Device:   device,
-			Channels: channels,
-			Latency:  device.DefaultLowInputLatency,
-		},
-		SampleRate:      sampleRate,
-		FramesPerBuffer: framesPerBuf,
+	if *play != "" {
+		if err := recorder.Play(ctx, *play, devices.first()); err != nil && !errors.Is(err, context.Canceled) {
+			fatalf("%v", err)
+		}
+		return
 	}
 
-	stream, err := portaudio.OpenStream(params, buffer)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer stream.Close()
+	cfg := recorder.Config{
+		Device:        devices.first(),
+		HostAPI:       *hostAPI,
+		Loopback:      *loopback,
+		Channels:      int(channels),
+		BitsPerSample: *bits,
+		Volume:        *volume,
+		GainDB:        *gainDB,
+		OutputPath:    *out,
+		Overwrite:     *force,
+		Append:        *appendOut,
+		Reconnect:     *reconnect,
+		Format:        recorder.FileFormat(*format),
+		Bitrate:       *bitrate,
+		ChannelMask:   uint32(*channelMask),
+		Planar:        *planar,
 
-	outFile, err := os.Create("micdropper.wav")
-	if err != nil {
-		log.Fatal(err)
+		OpusApplication: *opusApplication,
+		Duration:        *duration,
+		Countdown:       time.Duration(*countdown) * time.Second,
+		Prebuffer:       *prebuffer,
+		MaxDuration:     *maxDuration,
+		Split:           *split,
+		MaxSize:         int64(maxSize),
+		MinFree:         int64(minFree),
+		SampleRate:      *sampleRate,
+		ResampleRate:    *resample,
+		RatePolicy:      recorder.RatePolicy(*ratePolicy),
+		Mix:             recorder.MixMode(*mix),
+		Combine:         recorder.CombineMode(*downmixMode),
+		ChannelMap:      channelMap,
+		Dither:          recorder.DitherMode(*dither),
+		FramesPerBuffer: *frames,
+
+		ReconnectTimeout: *reconnectTimeout,
+		Verbose:          *verbose,
+
+		SilenceTimeout:   *silenceTimeout,
+		SilenceThreshold: *silenceThreshold,
+
+		Invert:         *invert,
+		InvertChannels: invertChannels,
+
+		DCBlock:       *dcBlock,
+		DCBlockCutoff: *dcBlockCutoff,
+		EQ:            eq,
+
+		GateOpen:    *gateOpen,
+		GateClose:   *gateClose,
+		GateAttack:  time.Duration(*gateAttack * float64(time.Millisecond)),
+		GateRelease: time.Duration(*gateRelease * float64(time.Millisecond)),
+
+		LimitThreshold: *limitThreshold,
+		LimitRelease:   time.Duration(*limitRelease * float64(time.Millisecond)),
+
+		VAD:         *vad,
+		VADPreRoll:  *vadPreRoll,
+		VADPostRoll: *vadPostRoll,
+
+		Monitor:       *monitor,
+		MonitorDevice: *monitorDevice,
+
+		Normalize:       *normalize,
+		NormalizeTarget: *normalizeTarget,
+		Trim:            *trim,
+		TrimMargin:      *trimMargin,
+
+		Title:   *title,
+		Artist:  *artist,
+		Comment: *comment,
+		BWF:     *bwf,
+	}
+	if *frames <= 0 {
+		fatalf("frames per buffer must be positive, got %d", *frames)
+	}
+	switch *latency {
+	case "low":
+	case "high":
+		cfg.HighLatency = true
+	default:
+		d, err := time.ParseDuration(*latency)
+		if err != nil || d <= 0 {
+			fatalf("invalid latency %q: want low, high or a positive duration", *latency)
+		}
+		cfg.Latency = d
+	}
+	if *sampleRate < 0 {
+		fatalf("sample rate must be positive, got %v", *sampleRate)
+	}
+	if len(channelMap) > 0 && !flagSet("channels") {
+		cfg.Channels = 0
+	}
+	if *channelMask > math.MaxUint32 {
+		fatalf("channel mask %#x does not fit in 32 bits", *channelMask)
+	}
+	switch *endian {
+	case "little":
+	case "big":
+		cfg.BigEndian = true
+	default:
+		fatalf("unknown byte order %q", *endian)
+	}
+	switch *downmix {
+	case "stereo":
+		cfg.Downmix = recorder.DownmixStereo
+	case "mono":
+		cfg.Downmix = recorder.DownmixMono
+	default:
+		fatalf("unknown downmix mode %q", *downmix)
+	}
+	if *floatSamples {
+		cfg.SampleFormat = recorder.Float32
+		cfg.BitsPerSample = 32
 	}
-	defer outFile.Close()
 
-	var samples []float64
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
+	if *source != "" {
+		if *duration <= 0 || len(devices) > 1 {
+			fatalf("-source needs -duration and no more than one -device")
+		}
+		b, err := sourceBackend(*source, max(1, int(channels)), *sampleRate, *duration)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		recorder.SetBackend(b)
+		cfg.Device = ""
+	}
 
-	log.Printf("Recording from '%s' at %.0fHz", device.Name, sampleRate)
-	stream.Start()
-	defer stream.Stop()
+	if *check {
+		specs := []string(devices)
+		if len(specs) == 0 {
+			specs = []string{""}
+		}
+		for _, spec := range specs {
+			c := cfg
+			if len(specs) > 1 {
+				c.Device, c.OutputPath = spec, devicePath(cfg.OutputPath, spec)
+			}
+			plan, err := checkConfig(c)
+			if err != nil {
+				fatalf("%v", err)
+			}
+			fmt.Println(plan)
+		}
+		return
+	}
 
-recordingLoop:
-	for {
+	opts := options{
+		wsAddr:      *wsAddr,
+		metricsAddr: *metricsAddr,
+		httpSinkURL: *httpSinkURL,
+		httpSinkWAV: *httpSinkWAV,
+		quiet:       *quiet,
+		stats:       *statsInterval,
+		summary:     *summary,
+		summaryFile: *summaryFile,
+		sidecar:     *sidecar,
+		timestamps:  *timestampPath,
+	}
+	if opts.stats < 0 {
+		fatalf("-stats-interval must not be negative")
+	}
+	if opts.sidecar && cfg.OutputPath == "-" {
+		fatalf("-sidecar needs a file output, not stdout")
+	}
+	// Closed before stop cancels ctx on return, which is no interrupt.
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		<-ctx.Done()
 		select {
-		case <-stop:
-			log.Println("Stopping...")
-			break recordingLoop
+		case <-finished:
+			return
 		default:
-			if err := stream.Read(); err != nil {
-				log.Fatal(err)
-			}
-			for _, s := range buffer {
-				sample := int16ToFloat64(s) * volume
-				if sample > 1.0 {
-					sample = 1.0
-				} else if sample < -1.0 {
-					sample = -1.0
-				}
-				samples = append(samples, sample)
-			}
 		}
+		forceExitOnInterrupt()
+		slog.Info("Stopping... press Ctrl+C again to abort without finalizing the output")
+	}()
+	run := record
+	switch {
+	case *replayBuffer > 0:
+		if len(devices) > 1 {
+			fatalf("-replay-buffer records a single -device")
+		}
+		if opts.timestamps != "" {
+			fatalf("-timestamp cannot be combined with -replay-buffer")
+		}
+		if cfg.BigEndian {
+			fatalf("-replay-buffer saves little-endian WAV files; -endian big applies to raw output only")
+		}
+		run = func(ctx context.Context, cfg recorder.Config, opts options) error {
+			return recordReplay(ctx, cfg, *replayBuffer, opts)
+		}
+	case len(devices) > 1:
+		if opts.timestamps != "" {
+			fatalf("-timestamp records a single -device")
+		}
+		if opts.stats > 0 {
+			fatalf("-stats-interval reports on a single -device")
+		}
+		run = func(ctx context.Context, cfg recorder.Config, opts options) error {
+			return recordDevices(ctx, cfg, devices, opts)
+		}
+	}
+	if err := run(ctx, cfg, opts); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// options are the command-line settings that are not part of
+// recorder.Config.
+type options struct {
+	wsAddr      string
+	metricsAddr string
+	httpSinkURL string
+	httpSinkWAV bool
+	quiet       bool
+	stats       time.Duration
+	summary     bool
+	summaryFile string
+	sidecar     bool
+	timestamps  string
+}
+
+// record runs a recording with cfg until ctx is done or it ends on its own.
+func record(ctx context.Context, cfg recorder.Config, opts options) error {
+	if opts.wsAddr != "" || opts.httpSinkURL != "" {
+		// A slow client must not hold up the file.
+		cfg.StreamDropPolicy = recorder.DropOnFull
+	}
+	if opts.httpSinkURL != "" {
+		cfg.StreamBuffers = httpSinkBuffers
+	}
+	if opts.timestamps != "" {
+		f, err := recorder.CreateOutput(opts.timestamps, cfg.Overwrite)
+		if err != nil {
+			return fmt.Errorf("timestamps: %w", err)
+		}
+		defer f.Close()
+		switch strings.ToLower(filepath.Ext(opts.timestamps)) {
+		case ".json", ".jsonl":
+			cfg.TimestampJSON = true
+		}
+		cfg.Timestamps = f
 	}
 
-	format := beep.Format{
-		SampleRate:  beep.SampleRate(sampleRate),
-		NumChannels: channels,
-		Precision:   2,
+	r, err := openRecorder(cfg)
+	if err != nil {
+		return err
+	}
+	if opts.metricsAddr != "" {
+		ms, err := serveMetrics(opts.metricsAddr, []string{cfg.Device}, []*recorder.Recorder{r})
+		if err != nil {
+			r.Stop()
+			return fmt.Errorf("metrics server: %w", err)
+		}
+		defer ms.Close()
+	}
+	if opts.wsAddr != "" {
+		ws, err := serveWebSocket(opts.wsAddr, r)
+		if err != nil {
+			r.Stop()
+			return fmt.Errorf("WebSocket server: %w", err)
+		}
+		defer ws.Close()
+	}
+	var sink *httpSink
+	if opts.httpSinkURL != "" {
+		sink, err = startHTTPSink(opts.httpSinkURL, r, opts.httpSinkWAV)
+		if err != nil {
+			r.Stop()
+			return fmt.Errorf("HTTP sink: %w", err)
+		}
+	}
+	go adjustVolume(os.Stdin, nil, r)
+	if !opts.quiet {
+		go showLevels(ctx, r, os.Stderr)
+	}
+	if opts.stats > 0 {
+		go showStats(ctx, r, os.Stderr, opts.stats)
 	}
 
-	if err := wav.Encode(outFile, multiChannelStreamer(samples, channels), format); err != nil {
-		log.Fatal(err)
+	err = r.Run(ctx)
+	if serr := writeSummary(opts, r.Summary()); serr != nil {
+		slog.Error("Writing summary failed", "err", serr)
+	}
+	if opts.sidecar {
+		if serr := writeSidecar(r.Summary(), cfg.Overwrite); serr != nil {
+			slog.Error("Writing sidecar failed", "err", serr)
+		}
+	}
+	if errors.Is(err, recorder.ErrDeviceLost) {
+		return fmt.Errorf("%w\nThe audio captured until then was saved; use -reconnect to wait for the device instead", err)
+	} else if err != nil && !errors.Is(err, context.Canceled) {
+		return err
 	}
 
-	log.Println("Recording saved")
+	slog.Info("Recording saved")
+	if sink != nil {
+		if err := sink.Wait(); err != nil {
+			return fmt.Errorf("HTTP sink: %w", err)
+		}
+		slog.Info("Upload finished")
+	}
+	return nil
 }
 
-func int16ToFloat64(s int16) float64 {
-	return float64(s) / float64(math.MaxInt16)
+// openRecorder opens a Recorder for cfg, writing to stdout if the output
+// path is "-". The format defaults to the one implied by the path.
+func openRecorder(cfg recorder.Config) (*recorder.Recorder, error) {
+	if cfg.OutputPath == "-" {
+		return recorder.NewRecorderTo(cfg, os.Stdout)
+	}
+	cfg, err := withFormat(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return recorder.NewRecorder(cfg)
 }
 
-func multiChannelStreamer(samples []float64, ch int) beep.Streamer {
-	i := 0
-	return beep.StreamerFunc(func(buf [][2]float64) (n int, ok bool) {
-		for j := 0; j < len(buf); j++ {
-			if i+ch > len(samples) {
-				return j, false
-			}
-			switch ch {
-			case 1:
-				val := samples[i]
-				buf[j][0] = val
-				buf[j][1] = val
-			case 2:
-				buf[j][0] = samples[i]
-				buf[j][1] = samples[i+1]
-			default:
-				sum := 0.0
-				for k := 0; k < ch && i+k < len(samples); k++ {
-					sum += samples[i+k]
-				}
-				avg := sum / float64(ch)
-				buf[j][0] = avg
-				buf[j][1] = avg
-			}
-			i += ch
-		}
-		return len(buf), true
-	})
+// checkConfig is the dry run of openRecorder.
+func checkConfig(cfg recorder.Config) (recorder.Plan, error) {
+	cfg, err := withFormat(cfg)
+	if err != nil {
+		return recorder.Plan{}, err
+	}
+	return recorder.Check(cfg)
 }
 
-func findWorkingSampleRate(dev *portaudio.DeviceInfo) (float64, error) {
-	for _, rate := range possibleSampleRates {
-		params := portaudio.StreamParameters{
-			Input: portaudio.StreamDeviceParameters{
-				Device:   dev,
-				Channels: channels,
-				Latency:  dev.DefaultLowInputLatency,
-			},
-			Output: portaudio.StreamDeviceParameters{
-				Channels: 0,
-			},
-			SampleRate:      rate,
-			FramesPerBuffer: framesPerBuf,
-		}
+// withFormat sets the format of cfg from its output path unless the format
+// is given or the output is stdout.
+func withFormat(cfg recorder.Config) (recorder.Config, error) {
+	if cfg.OutputPath == "-" || cfg.Format != "" {
+		return cfg, nil
+	}
+	f, err := recorder.FormatForPath(cfg.OutputPath)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Format = f
+	return cfg, nil
+}
+
+// setupLogging makes a handler for the given level and format the default
+// slog logger, which the recorder package logs to as well.
+func setupLogging(level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+	return nil
+}
+
+// fatalf logs an error and exits with status 1.
+func fatalf(format string, args ...any) {
+	slog.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// forceExitOnInterrupt makes the next interrupt end the process at once,
+// for when finishing a recording hangs, e.g. on a stalled sink. Whatever
+// is still buffered is lost and headers are left unpatched, so WAV files
+// declare no or a wrong length until fixed with -repair, and encoded
+// outputs may be truncated.
+func forceExitOnInterrupt() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		slog.Error("Aborted; the output was not finalized")
+		os.Exit(130)
+	}()
+}
 
-		if err := portaudio.IsFormatSupported(params, []int16{}); err == nil {
-			return rate, nil
+// wrapRaw writes each of the headerless PCM files srcs as a WAV file, to out
+// if it was given for a single file and next to the source otherwise.
+func wrapRaw(srcs []string, info recorder.StreamInfo, out string, force bool) {
+	outSet := flagSet("out")
+	if outSet && len(srcs) > 1 {
+		fatalf("-out names a single file; leave it out to wrap several")
+	}
+	if info.Float {
+		info.BitsPerSample = 32
+	}
+	for _, src := range srcs {
+		dst := strings.TrimSuffix(src, filepath.Ext(src)) + ".wav"
+		if outSet {
+			dst = out
 		}
+		if err := recorder.WrapRaw(src, dst, info, force); err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Printf("Wrapped %s as %s\n", src, dst)
+	}
+}
+
+// compareWav compares the WAV file a with the one in args and exits with
+// status 1 if they differ beyond tolerance.
+func compareWav(a string, args []string, tolerance float64) {
+	if len(args) != 1 {
+		fatalf("-compare needs the WAV file to compare with as its only argument")
+	}
+	if tolerance < 0 {
+		fatalf("-tolerance must not be negative")
 	}
-	return 0, os.ErrInvalid
+	b := args[0]
+	d, err := recorder.CompareWav(a, b, tolerance)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Printf("Compared %d samples; the largest difference is %g (%.1f dBFS)\n", d.Samples, d.MaxDiff, 20*math.Log10(d.MaxDiff))
+	if d.First >= 0 {
+		fmt.Printf("First difference beyond %g at sample %d (frame %d, channel %d)\n", tolerance, d.First, d.First/int64(d.Channels), d.First%int64(d.Channels))
+	}
+	switch {
+	case d.Extra > 0:
+		fmt.Printf("%s has %d more samples\n", b, d.Extra)
+	case d.Extra < 0:
+		fmt.Printf("%s has %d more samples\n", a, -d.Extra)
+	}
+	if d.Differ() {
+		os.Exit(1)
+	}
+	fmt.Println("The files match")
+}
+
+// flagSet reports whether the flag name was given on the command line or in
+// the -config file.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"audio-grab/recorder"
+)
+
+// metric is one series family of the Prometheus text exposition format.
+type metric struct {
+	name, kind, help string
+	value            func(r *recorder.Recorder) float64
+}
+
+// labelEscaper escapes label values as the text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+var metrics = []metric{
+	{"audiograb_captured_frames_total", "counter", "Frames captured from the input device.",
+		func(r *recorder.Recorder) float64 { return float64(r.FramesCaptured()) }},
+	{"audiograb_recorded_seconds", "gauge", "Length of the audio captured so far.",
+		func(r *recorder.Recorder) float64 { return float64(r.FramesCaptured()) / r.SampleRate() }},
+	{"audiograb_written_bytes_total", "counter", "Sample data written to the output.",
+		func(r *recorder.Recorder) float64 { return float64(r.BytesWritten()) }},
+	{"audiograb_overflows_total", "counter", "Input overflows, each of which dropped some audio.",
+		func(r *recorder.Recorder) float64 { return float64(r.Overflows()) }},
+	{"audiograb_input_peak_dbfs", "gauge", "Peak level of the last captured buffer.",
+		func(r *recorder.Recorder) float64 { return r.Level().Peak }},
+	{"audiograb_input_rms_dbfs", "gauge", "RMS level of the last captured buffer.",
+		func(r *recorder.Recorder) float64 { return r.Level().RMS }},
+}
+
+// metricsServer serves Prometheus metrics of running recorders, labelled
+// by the device spec each records.
+type metricsServer struct {
+	srv     *http.Server
+	devices []string
+	rs      []*recorder.Recorder
+}
+
+// serveMetrics serves the metrics of rs, which record devices, on addr. An
+// empty spec is labelled "default".
+func serveMetrics(addr string, devices []string, rs []*recorder.Recorder) (*metricsServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]string, len(devices))
+	for i, d := range devices {
+		if d == "" {
+			d = "default"
+		}
+		labels[i] = labelEscaper.Replace(d)
+	}
+	s := &metricsServer{devices: labels, rs: rs}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handle)
+	s.srv = &http.Server{Handler: mux}
+	go s.srv.Serve(ln)
+	slog.Info("Serving metrics", "url", "http://"+ln.Addr().String()+"/metrics")
+	return s, nil
+}
+
+func (s *metricsServer) Close() error { return s.srv.Close() }
+
+func (s *metricsServer) handle(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, s.devices, s.rs)
+}
+
+// writeMetrics writes every metric of every recorder in the text exposition
+// format.
+func writeMetrics(w io.Writer, devices []string, rs []*recorder.Recorder) {
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for i, r := range rs {
+			fmt.Fprintf(w, "%s{device=\"%s\"} %s\n", m.name, devices[i], strconv.FormatFloat(m.value(r), 'g', -1, 64))
+		}
+	}
+}
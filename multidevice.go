@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"audio-grab/recorder"
+)
+
+// deviceList collects the values of a repeated -device flag.
+type deviceList []string
+
+func (d *deviceList) String() string { return strings.Join(*d, ",") }
+
+func (d *deviceList) Set(spec string) error {
+	*d = append(*d, spec)
+	return nil
+}
+
+// first returns the only device of a single-device run, or "" for the
+// default input.
+func (d deviceList) first() string {
+	if len(d) == 0 {
+		return ""
+	}
+	return d[0]
+}
+
+// recordDevices records each of specs into its own file, named after
+// cfg.OutputPath with the device spec appended, until ctx is done. The
+// recordings run concurrently and all stop together.
+func recordDevices(ctx context.Context, cfg recorder.Config, specs []string, opts options) error {
+	if cfg.OutputPath == "-" {
+		return errors.New("recording several devices needs a file output, not stdout")
+	}
+	if opts.wsAddr != "" || opts.httpSinkURL != "" {
+		return errors.New("-ws-addr and -http-sink support a single device only")
+	}
+
+	var rs []*recorder.Recorder
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		c := cfg
+		c.Device = spec
+		c.OutputPath = devicePath(cfg.OutputPath, spec)
+		if seen[c.OutputPath] {
+			return fmt.Errorf("device %q given twice", spec)
+		}
+		seen[c.OutputPath] = true
+
+		r, err := openRecorder(c)
+		if err != nil {
+			for _, r := range rs {
+				r.Stop()
+			}
+			return fmt.Errorf("device %q: %w", spec, err)
+		}
+		rs = append(rs, r)
+	}
+	if opts.metricsAddr != "" {
+		ms, err := serveMetrics(opts.metricsAddr, specs, rs)
+		if err != nil {
+			for _, r := range rs {
+				r.Stop()
+			}
+			return fmt.Errorf("metrics server: %w", err)
+		}
+		defer ms.Close()
+	}
+	go adjustVolume(os.Stdin, nil, rs...)
+
+	errs := make([]error, len(rs))
+	var wg sync.WaitGroup
+	for i, r := range rs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				errs[i] = fmt.Errorf("device %q: %w", specs[i], err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	summaries := make([]recorder.RecordingSummary, len(rs))
+	for i, r := range rs {
+		summaries[i] = r.Summary()
+		if opts.sidecar {
+			if err := writeSidecar(summaries[i], cfg.Overwrite); err != nil {
+				slog.Error("Writing sidecar failed", "device", specs[i], "err", err)
+			}
+		}
+		frames := r.FramesCaptured()
+		length := time.Duration(float64(frames) / r.SampleRate() * float64(time.Second))
+		slog.Info("Device finished", "device", specs[i], "frames", frames, "length", length.Round(time.Millisecond), "overflows", r.Overflows(), "path", devicePath(cfg.OutputPath, specs[i]))
+	}
+	if err := writeSummary(opts, summaries...); err != nil {
+		slog.Error("Writing summary failed", "err", err)
+	}
+	return errors.Join(errs...)
+}
+
+// devicePath inserts a file-name-safe form of the device spec before the
+// extension of path, e.g. out.wav and "USB Mic" give out-usb-mic.wav.
+func devicePath(path, spec string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, spec)
+	name = strings.Trim(name, "-")
+	if name == "" {
+		name = "default"
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
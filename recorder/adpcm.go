@@ -0,0 +1,195 @@
+package recorder
+
+// IMA ADPCM compresses 16-bit samples to 4 bits each. Samples are coded in
+// blocks that start with a header per channel holding the first sample and
+// the step index, so every block decodes on its own.
+
+const (
+	wavFormatIMAADPCM = 0x11
+
+	adpcmBlockHeader = 4 // Bytes per channel.
+)
+
+var adpcmStepTable = [89]int32{
+	7, 8, 9, 10, 11, 12, 13, 14, 16, 17, 19, 21, 23, 25, 28, 31, 34, 37, 41,
+	45, 50, 55, 60, 66, 73, 80, 88, 97, 107, 118, 130, 143, 157, 173, 190, 209,
+	230, 253, 279, 307, 337, 371, 408, 449, 494, 544, 598, 658, 724, 796, 876,
+	963, 1060, 1166, 1282, 1411, 1552, 1707, 1878, 2066, 2272, 2499, 2749, 3024,
+	3327, 3660, 4026, 4428, 4871, 5358, 5894, 6484, 7132, 7845, 8630, 9493,
+	10442, 11487, 12635, 13899, 15289, 16818, 18500, 20350, 22385, 24623, 27086,
+	29794, 32767,
+}
+
+var adpcmIndexTable = [16]int{-1, -1, -1, -1, 2, 4, 6, 8, -1, -1, -1, -1, 2, 4, 6, 8}
+
+// adpcmBlockAlign returns the block size used for the given layout: 256
+// bytes per channel, doubled with every doubling of the rate from 22050 Hz,
+// up to 2048.
+func adpcmBlockAlign(channels int, rate float64) int {
+	n := 256
+	for r := rate; r >= 2*11025 && n < 2048; r /= 2 {
+		n *= 2
+	}
+	return n * channels
+}
+
+// adpcmFramesPerBlock returns the frames held by a block of blockAlign bytes:
+// the one in the header plus two per data byte and channel.
+func adpcmFramesPerBlock(channels, blockAlign int) int {
+	return (blockAlign-adpcmBlockHeader*channels)*2/channels + 1
+}
+
+// adpcmFormat returns the fmt chunk of an IMA ADPCM WAV file, with the
+// extension declaring the frames per block.
+func adpcmFormat(sampleRate, channels int) (wavFormat, []byte) {
+	blockAlign := adpcmBlockAlign(channels, float64(sampleRate))
+	perBlock := adpcmFramesPerBlock(channels, blockAlign)
+	format := wavFormat{
+		AudioFormat:   wavFormatIMAADPCM,
+		NumChannels:   uint16(channels),
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * blockAlign / perBlock),
+		BlockAlign:    uint16(blockAlign),
+		BitsPerSample: 4,
+	}
+	// cbSize, then wSamplesPerBlock.
+	return format, []byte{2, 0, byte(perBlock), byte(perBlock >> 8)}
+}
+
+type adpcmChannel struct {
+	predictor int32
+	index     int
+}
+
+// adpcmEncoder gathers interleaved samples into blocks and encodes each block
+// once it is full.
+type adpcmEncoder struct {
+	channels   int
+	blockAlign int
+	perBlock   int
+	pending    []int16 // Interleaved frames of the block being filled.
+	state      []adpcmChannel
+	nibbles    []byte
+}
+
+func newADPCMEncoder(channels int, rate float64) *adpcmEncoder {
+	blockAlign := adpcmBlockAlign(channels, rate)
+	perBlock := adpcmFramesPerBlock(channels, blockAlign)
+	return &adpcmEncoder{
+		channels:   channels,
+		blockAlign: blockAlign,
+		perBlock:   perBlock,
+		pending:    make([]int16, 0, perBlock*channels),
+		state:      make([]adpcmChannel, channels),
+		nibbles:    make([]byte, perBlock-1),
+	}
+}
+
+// push adds the next sample and, once it completes a block, appends the
+// encoded block to b.
+func (e *adpcmEncoder) push(b []byte, s int16) []byte {
+	e.pending = append(e.pending, s)
+	if len(e.pending) < cap(e.pending) {
+		return b
+	}
+	return e.encodeBlock(b)
+}
+
+// flush completes a partly filled block with silence and appends it to b. It
+// returns the number of frames of padding.
+func (e *adpcmEncoder) flush(b []byte) ([]byte, int) {
+	if len(e.pending) == 0 {
+		return b, 0
+	}
+	pad := e.perBlock - len(e.pending)/e.channels
+	for len(e.pending) < cap(e.pending) {
+		e.pending = append(e.pending, 0)
+	}
+	return e.encodeBlock(b), pad
+}
+
+func (e *adpcmEncoder) encodeBlock(b []byte) []byte {
+	start := len(b)
+	for c := range e.channels {
+		first := e.pending[c]
+		st := &e.state[c]
+		st.predictor = int32(first)
+		b = append(b, byte(first), byte(uint16(first)>>8), byte(st.index), 0)
+	}
+	for c := range e.channels {
+		st := &e.state[c]
+		for i := range e.nibbles {
+			e.nibbles[i] = st.encode(e.pending[(i+1)*e.channels+c])
+		}
+		// Each channel contributes runs of eight samples in four bytes,
+		// low nibble first.
+		for i := 0; i < len(e.nibbles); i += 8 {
+			off := start + adpcmBlockHeader*e.channels + (i/8*e.channels+c)*4
+			if len(b) < off+4 {
+				b = append(b, make([]byte, off+4-len(b))...)
+			}
+			for j := range 4 {
+				b[off+j] = e.nibbles[i+2*j] | e.nibbles[i+2*j+1]<<4
+			}
+		}
+	}
+	e.pending = e.pending[:0]
+	return b
+}
+
+// encode returns the 4-bit code for s and advances the predictor as the
+// decoder will.
+func (st *adpcmChannel) encode(s int16) byte {
+	step := adpcmStepTable[st.index]
+	diff := int32(s) - st.predictor
+	var code byte
+	if diff < 0 {
+		code = 8
+		diff = -diff
+	}
+	delta := step >> 3
+	for bit := byte(4); bit > 0; bit >>= 1 {
+		if diff >= step {
+			code |= bit
+			diff -= step
+			delta += step
+		}
+		step >>= 1
+	}
+	if code&8 != 0 {
+		st.predictor -= delta
+	} else {
+		st.predictor += delta
+	}
+	st.predictor = max(-32768, min(32767, st.predictor))
+	st.index = max(0, min(len(adpcmStepTable)-1, st.index+adpcmIndexTable[code]))
+	return code
+}
+
+// dataFrames returns the number of frames in n bytes of sample data of the
+// output.
+func (r *Recorder) dataFrames(n int64) int64 {
+	if r.adpcm != nil {
+		return n / int64(r.adpcm.blockAlign) * int64(r.adpcm.perBlock)
+	}
+	return n / int64(r.cfg.outputChannels()*r.cfg.outputBits()/8)
+}
+
+// flushADPCM writes the last, partly filled ADPCM block of the recording and
+// records its padding for the fact chunk.
+func (r *Recorder) flushADPCM() error {
+	if r.adpcm == nil || r.out == nil {
+		return nil
+	}
+	b, pad := r.adpcm.flush(nil)
+	if len(b) == 0 {
+		return nil
+	}
+	if _, err := r.out.Write(b); err != nil {
+		return err
+	}
+	r.totalBytesWritten += int64(len(b))
+	r.dataBytes.Add(int64(len(b)))
+	r.wavLayout.padFrames = pad
+	return nil
+}
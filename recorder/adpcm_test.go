@@ -0,0 +1,151 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"slices"
+	"testing"
+)
+
+// decodeADPCM decodes IMA ADPCM blocks of blockAlign bytes into interleaved
+// samples, as a WAV reader would.
+func decodeADPCM(b []byte, channels, blockAlign int) []int16 {
+	perBlock := adpcmFramesPerBlock(channels, blockAlign)
+	var out []int16
+	for ; len(b) >= blockAlign; b = b[blockAlign:] {
+		frames := make([]int16, perBlock*channels)
+		for c := range channels {
+			st := adpcmChannel{
+				predictor: int32(int16(binary.LittleEndian.Uint16(b[adpcmBlockHeader*c:]))),
+				index:     int(b[adpcmBlockHeader*c+2]),
+			}
+			frames[c] = int16(st.predictor)
+			for i := range perBlock - 1 {
+				off := adpcmBlockHeader*channels + (i/8*channels+c)*4 + i%8/2
+				code := b[off] >> (4 * (i % 2)) & 0xF
+				frames[(i+1)*channels+c] = decodeADPCMSample(&st, code)
+			}
+		}
+		out = append(out, frames...)
+	}
+	return out
+}
+
+func decodeADPCMSample(st *adpcmChannel, code byte) int16 {
+	step := adpcmStepTable[st.index]
+	delta := step >> 3
+	if code&4 != 0 {
+		delta += step
+	}
+	if code&2 != 0 {
+		delta += step >> 1
+	}
+	if code&1 != 0 {
+		delta += step >> 2
+	}
+	if code&8 != 0 {
+		st.predictor -= delta
+	} else {
+		st.predictor += delta
+	}
+	st.predictor = max(-32768, min(32767, st.predictor))
+	st.index = max(0, min(len(adpcmStepTable)-1, st.index+adpcmIndexTable[code]))
+	return int16(st.predictor)
+}
+
+// newSmallADPCMEncoder returns an encoder of blocks of blockAlign bytes,
+// smaller than any rate uses, for blocks short enough to spell out.
+func newSmallADPCMEncoder(channels, blockAlign int) *adpcmEncoder {
+	perBlock := adpcmFramesPerBlock(channels, blockAlign)
+	return &adpcmEncoder{
+		channels:   channels,
+		blockAlign: blockAlign,
+		perBlock:   perBlock,
+		pending:    make([]int16, 0, perBlock*channels),
+		state:      make([]adpcmChannel, channels),
+		nibbles:    make([]byte, perBlock-1),
+	}
+}
+
+func TestADPCMReference(t *testing.T) {
+	// Blocks of 17 frames, coded and decoded by an independent IMA ADPCM
+	// implementation. The second mono block starts with the step index
+	// the first ended on.
+	ramp, square := make([]int16, 17), make([]int16, 17)
+	for i := range 17 {
+		ramp[i], square[i] = int16(i*1500), int16(-i*i*100)
+	}
+	var stereo []int16
+	for i := range 17 {
+		stereo = append(stereo, ramp[i], square[i])
+	}
+	for _, tt := range []struct {
+		name     string
+		channels int
+		in       []int16
+		blocks   string
+		decoded  []int16
+	}{
+		{
+			"mono", 1,
+			[]int16{
+				0, 1000, 3000, 6000, 10000, 12000, 8000, 2000, -4000, -9000, -12000, -10000, -5000, 0, 3000, 4000, 4500,
+				4000, 3000, 1500, 0, -1500, -3000, -32768, 32767, 20000, 100, -100, 50, -50, 0, 0, 7, 0,
+			},
+			"00000000777777f4ff202200" + "a00f44009899fa478c000888",
+			[]int16{
+				0, 11, 41, 104, 240, 533, 1164, 1978, 336, -3184, -10732, -9654, -4752, -295, 3757, 4493, 5162,
+				4000, 3392, 1732, 223, -1149, -3227, -8897, 3260, 18896, -24, -2567, -255, 1847, -64, 1673, 94, -1341,
+			},
+		},
+		{
+			"stereo", 2, stereo,
+			"000000000000000077777777ffffffff17011101abbaccbb",
+			[]int16{
+				0, 0, 11, -11, 41, -41, 104, -104, 240, -240, 533, -533, 1164, -1164, 2521, -2521, 5431, -5431,
+				11667, -8340, 14341, -10230, 16772, -11947, 17508, -14132, 19516, -16688, 21341, -19780, 23001, -22689, 23504, -25335,
+			},
+		},
+	} {
+		blockAlign := adpcmBlockHeader*tt.channels + 8*tt.channels
+		e := newSmallADPCMEncoder(tt.channels, blockAlign)
+		var got []byte
+		for _, s := range tt.in {
+			got = e.push(got, s)
+		}
+		want, _ := hex.DecodeString(tt.blocks)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: encoded\n%x\nwant\n%x", tt.name, got, want)
+		}
+		if dec := decodeADPCM(want, tt.channels, blockAlign); !slices.Equal(dec, tt.decoded) {
+			t.Errorf("%s: decoded\n%v\nwant\n%v", tt.name, dec, tt.decoded)
+		}
+	}
+}
+
+func TestRecordADPCM(t *testing.T) {
+	const frames = 4800
+	samples := make([]float64, 2*frames)
+	for i := range frames {
+		s := 0.5 * math.Sin(2*math.Pi*440*float64(i)/48000)
+		samples[2*i], samples[2*i+1] = s, -s
+	}
+	b := record(t, Config{Channels: 2, Format: FormatADPCM}, 2, frames, samples)
+	blockAlign := int(binary.LittleEndian.Uint16(b[32:]))
+	data := chunk(b, "data")
+	if len(data)%blockAlign != 0 {
+		t.Fatalf("%d bytes of data in blocks of %d", len(data), blockAlign)
+	}
+	dec := decodeADPCM(data, 2, blockAlign)
+	if len(dec) < 2*frames {
+		t.Fatalf("%d samples decoded, want %d", len(dec), 2*frames)
+	}
+	// The step size adapts to the signal over the first few samples.
+	for i := 2 * 32; i < 2*frames; i++ {
+		if want := samples[i] * math.MaxInt16; math.Abs(float64(dec[i])-want) > 400 {
+			t.Fatalf("sample %d decodes to %d, want about %.0f", i, dec[i], want)
+		}
+	}
+}
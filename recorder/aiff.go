@@ -0,0 +1,96 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// AIFF header layout: FORM header (12 bytes), COMM chunk (26 bytes) and the
+// SSND chunk header including its offset and block size fields (16 bytes).
+const (
+	aiffFormSizeOffset   = 4
+	aiffNumFramesOffset  = 22
+	aiffSsndSizeOffset   = 42
+	aiffHeaderSize       = 54
+	aiffCommChunkSize    = 18
+	aiffSsndFieldsLength = 8
+)
+
+// writeAiffHeader writes the FORM, COMM and SSND chunk headers declaring
+// dataSize bytes of big-endian sample data. As with WAV, seekable outputs
+// start with zero sizes that updateAiffHeader patches at the end.
+func writeAiffHeader(w io.Writer, sampleRate, numChannels, bitsPerSample int, dataSize uint32) error {
+	formSize := uint32(aiffHeaderSize-8) + dataSize
+	ssndSize := aiffSsndFieldsLength + dataSize
+	numFrames := dataSize / uint32(numChannels*bitsPerSample/8)
+	if dataSize == unknownDataSize {
+		formSize, ssndSize, numFrames = unknownDataSize, unknownDataSize, unknownDataSize
+	}
+
+	b := make([]byte, 0, aiffHeaderSize)
+	b = append(b, "FORM"...)
+	b = binary.BigEndian.AppendUint32(b, formSize)
+	b = append(b, "AIFF"...)
+
+	b = append(b, "COMM"...)
+	b = binary.BigEndian.AppendUint32(b, aiffCommChunkSize)
+	b = binary.BigEndian.AppendUint16(b, uint16(numChannels))
+	b = binary.BigEndian.AppendUint32(b, numFrames)
+	b = binary.BigEndian.AppendUint16(b, uint16(bitsPerSample))
+	rate := float64ToExtended(float64(sampleRate))
+	b = append(b, rate[:]...)
+
+	b = append(b, "SSND"...)
+	b = binary.BigEndian.AppendUint32(b, ssndSize)
+	b = binary.BigEndian.AppendUint32(b, 0) // Offset.
+	b = binary.BigEndian.AppendUint32(b, 0) // Block size.
+
+	_, err := w.Write(b)
+	return err
+}
+
+// updateAiffHeader patches the chunk sizes and frame count once dataSize is
+// known. Chunks must have an even length, so an odd amount of sample data is
+// followed by a pad byte that is counted in the FORM size only.
+func updateAiffHeader(w io.WriteSeeker, numChannels, bitsPerSample int, dataSize uint32) error {
+	formSize := uint32(aiffHeaderSize-8) + dataSize
+	if dataSize%2 != 0 {
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+		formSize++
+	}
+
+	fields := []struct {
+		offset int64
+		value  uint32
+	}{
+		{aiffFormSizeOffset, formSize},
+		{aiffNumFramesOffset, dataSize / uint32(numChannels*bitsPerSample/8)},
+		{aiffSsndSizeOffset, aiffSsndFieldsLength + dataSize},
+	}
+	for _, f := range fields {
+		if _, err := w.Seek(f.offset, io.SeekStart); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, f.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// float64ToExtended encodes a non-negative f as the 80-bit IEEE 754 extended
+// precision value AIFF uses for the sample rate: a 15-bit biased exponent
+// followed by a 64-bit mantissa with an explicit integer bit.
+func float64ToExtended(f float64) [10]byte {
+	var b [10]byte
+	if f <= 0 {
+		return b
+	}
+	frac, exp := math.Frexp(f) // f = frac * 2^exp, 0.5 <= frac < 1.
+	binary.BigEndian.PutUint16(b[0:], uint16(exp-1+16383))
+	binary.BigEndian.PutUint64(b[2:], uint64(frac*(1<<64)))
+	return b
+}
@@ -0,0 +1,117 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// appendTarget is an existing WAV file that a recording continues, opened
+// and positioned at the end of its sample data.
+type appendTarget struct {
+	f          *os.File
+	sampleRate float64
+	channels   int
+	layout     wavLayout
+	dataSize   uint32
+}
+
+// openAppend opens the WAV file at path for Config.Append and checks that
+// its format matches cfg. It returns nil without error if the file does not
+// exist, in which case the recording starts a new one.
+func openAppend(path string, cfg Config) (*appendTarget, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening output: %w", err)
+	}
+	t, err := readAppendTarget(f, cfg)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot append to %s: %w", path, err)
+	}
+	return t, nil
+}
+
+func readAppendTarget(f *os.File, cfg Config) (*appendTarget, error) {
+	format, dataSize, err := readWavHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	if dataSize == unknownDataSize {
+		return nil, errors.New("the header does not record the data size")
+	}
+	switch {
+	case format.AudioFormat != wavFormatTag(cfg.SampleFormat):
+		return nil, fmt.Errorf("it holds WAV format %d, not %d", format.AudioFormat, wavFormatTag(cfg.SampleFormat))
+	case cfg.Channels != AllChannels && int(format.NumChannels) != cfg.outputChannels():
+		return nil, fmt.Errorf("it has %d channels, not %d", format.NumChannels, cfg.outputChannels())
+	case int(format.BitsPerSample) != cfg.BitsPerSample:
+		return nil, fmt.Errorf("it has %d bits per sample, not %d", format.BitsPerSample, cfg.BitsPerSample)
+	}
+	if rate := cfg.outputRate(); rate > 0 && rate != float64(format.SampleRate) {
+		return nil, fmt.Errorf("it is sampled at %d Hz, not %.0f Hz", format.SampleRate, rate)
+	}
+
+	dataStart, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	end := dataStart + int64(dataSize)
+	if info.Size() < end {
+		return nil, errors.New("the data chunk is truncated")
+	}
+	if info.Size() > end+int64(dataSize&1) {
+		return nil, errors.New("chunks follow the data chunk")
+	}
+
+	layout := wavLayout{headerSize: int(dataStart), blockAlign: int(format.BlockAlign)}
+	// Extensible PCM files have a fact chunk as well.
+	if layout.factOffset, err = findFactCount(f, dataStart); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &appendTarget{f: f, sampleRate: float64(format.SampleRate), channels: int(format.NumChannels), layout: layout, dataSize: dataSize}, nil
+}
+
+// outputRate returns the requested sample rate of the output, zero if it is
+// left to the device.
+func (cfg Config) outputRate() float64 {
+	if cfg.ResampleRate > 0 {
+		return cfg.ResampleRate
+	}
+	return cfg.SampleRate
+}
+
+// findFactCount returns the offset of the sample count in the fact chunk of
+// a WAV file whose sample data starts at dataStart, or zero if there is no
+// fact chunk.
+func findFactCount(f io.ReadSeeker, dataStart int64) (int64, error) {
+	pos := int64(12)
+	for pos+8 < dataStart {
+		if _, err := f.Seek(pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+		var hdr [8]byte
+		if _, err := io.ReadFull(f, hdr[:]); err != nil {
+			return 0, truncated("chunk header", err)
+		}
+		if string(hdr[0:4]) == "fact" {
+			return pos + 8, nil
+		}
+		size := int64(binary.LittleEndian.Uint32(hdr[4:8]))
+		pos += 8 + size + size&1
+	}
+	return 0, nil
+}
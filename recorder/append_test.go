@@ -0,0 +1,41 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRejectedAppendLeavesFileUnchanged(t *testing.T) {
+	// The device lacks the rate of the file, which is only found out once
+	// the stream is planned.
+	useFakeBackend(t, 1, 48000, nil)
+	// Quiet audio, which Normalize would raise if it ran.
+	data := make([]byte, 400)
+	for i := 0; i < len(data); i += 2 {
+		binary.LittleEndian.PutUint16(data[i:], 1000)
+	}
+	var want bytes.Buffer
+	if err := WriteWav(&want, StreamInfo{SampleRate: 44100, Channels: 1, BitsPerSample: 16}, data); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "take.wav")
+	if err := os.WriteFile(path, want.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{OutputPath: path, Append: true, Normalize: true, Volume: 1, Duration: time.Second}
+	if _, err := NewRecorder(cfg); err == nil {
+		t.Fatal("appending 48 kHz audio to a 44.1 kHz file succeeded")
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Error("the rejected append changed the file")
+	}
+}
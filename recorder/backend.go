@@ -0,0 +1,135 @@
+package recorder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// AudioBackend is the audio system the package captures from and plays to.
+// The default wraps PortAudio; FakeBackend stands in for it without audio
+// hardware. The methods mirror the PortAudio functions of the same names.
+type AudioBackend interface {
+	Initialize() error
+	Terminate() error
+	Devices() ([]*portaudio.DeviceInfo, error)
+	DefaultInputDevice() (*portaudio.DeviceInfo, error)
+	DefaultOutputDevice() (*portaudio.DeviceInfo, error)
+	DefaultHostApi() (*portaudio.HostApiInfo, error)
+	IsFormatSupported(p portaudio.StreamParameters, buffers ...interface{}) error
+	OpenStream(p portaudio.StreamParameters, buffers ...interface{}) (Stream, error)
+}
+
+// Stream is a blocking stream opened by an AudioBackend. Read fills the
+// input buffer the stream was opened with and Write plays its output buffer.
+// Info and Time report the latencies and clock of the stream as PortAudio
+// does; Info may return nil.
+type Stream interface {
+	Start() error
+	Stop() error
+	Close() error
+	Read() error
+	Write() error
+	Info() *portaudio.StreamInfo
+	Time() time.Duration
+}
+
+var audioBackend AudioBackend = portAudioBackend{}
+
+// SetBackend makes b the backend of Recorders created from then on, and of
+// Play and ListDevices. A nil b restores PortAudio. It must not be called
+// while a Recorder is open.
+func SetBackend(b AudioBackend) {
+	if b == nil {
+		b = portAudioBackend{}
+	}
+	audioBackend = b
+}
+
+func backend() AudioBackend {
+	return audioBackend
+}
+
+// backendUsers counts the callers of ensurePortAudio not yet matched by
+// releasePortAudio, so that Recorders open at the same time share a single
+// initialization of the backend.
+var (
+	backendMu    sync.Mutex
+	backendUsers int
+)
+
+// ensurePortAudio initializes the backend unless another user already has.
+// Every successful call must be matched by one of releasePortAudio.
+func ensurePortAudio() error {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	if backendUsers == 0 {
+		if err := backend().Initialize(); err != nil {
+			return err
+		}
+	}
+	backendUsers++
+	return nil
+}
+
+// releasePortAudio terminates the backend once its last user is done.
+func releasePortAudio() error {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	if backendUsers == 0 {
+		return nil
+	}
+	backendUsers--
+	if backendUsers > 0 {
+		return nil
+	}
+	return backend().Terminate()
+}
+
+// rescanPortAudio reinitializes the backend so that it sees devices plugged
+// in since, which PortAudio only enumerates when initialized. That would
+// break the streams of other users, so with those it does nothing.
+func rescanPortAudio() error {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	if backendUsers > 1 {
+		return nil
+	}
+	backend().Terminate()
+	return backend().Initialize()
+}
+
+type portAudioBackend struct{}
+
+func (portAudioBackend) Initialize() error { return portaudio.Initialize() }
+func (portAudioBackend) Terminate() error  { return portaudio.Terminate() }
+
+func (portAudioBackend) Devices() ([]*portaudio.DeviceInfo, error) {
+	return portaudio.Devices()
+}
+
+func (portAudioBackend) DefaultInputDevice() (*portaudio.DeviceInfo, error) {
+	return portaudio.DefaultInputDevice()
+}
+
+func (portAudioBackend) DefaultOutputDevice() (*portaudio.DeviceInfo, error) {
+	return portaudio.DefaultOutputDevice()
+}
+
+func (portAudioBackend) DefaultHostApi() (*portaudio.HostApiInfo, error) {
+	return portaudio.DefaultHostApi()
+}
+
+func (portAudioBackend) IsFormatSupported(p portaudio.StreamParameters, buffers ...interface{}) error {
+	return portaudio.IsFormatSupported(p, buffers...)
+}
+
+func (portAudioBackend) OpenStream(p portaudio.StreamParameters, buffers ...interface{}) (Stream, error) {
+	s, err := portaudio.OpenStream(p, buffers...)
+	if err != nil {
+		// Not a nil *portaudio.Stream in a non-nil Stream.
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,55 @@
+package recorder
+
+import (
+	"testing"
+	"time"
+)
+
+func users() int {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	return backendUsers
+}
+
+func TestSequentialRecorders(t *testing.T) {
+	useFakeBackend(t, 1, 48000, nil)
+	for i := range 2 {
+		var out MemBuffer
+		r, err := NewRecorderTo(Config{Volume: 1, Duration: 10 * time.Millisecond}, &out)
+		if err != nil {
+			t.Fatalf("recorder %d: %v", i, err)
+		}
+		if err := r.Run(t.Context()); err != nil {
+			t.Fatalf("recorder %d: %v", i, err)
+		}
+		if n := users(); n != 0 {
+			t.Fatalf("recorder %d left %d users of the backend", i, n)
+		}
+	}
+}
+
+func TestStopTwice(t *testing.T) {
+	useFakeBackend(t, 1, 48000, nil)
+	var out1, out2 MemBuffer
+	r1, err := NewRecorderTo(Config{Volume: 1}, &out1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := NewRecorderTo(Config{Volume: 1}, &out2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Stop()
+	if err := r1.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := r1.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// r2 still holds the backend.
+	if n := users(); n != 1 {
+		t.Errorf("%d users of the backend, want 1", n)
+	}
+}
@@ -0,0 +1,37 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// bextChunk returns the encoded Broadcast Wave bext chunk (EBU Tech 3285,
+// version 1) for a recording starting at start, or nil unless Config.BWF is
+// set. Comment and Artist fill the description and originator fields; the
+// time reference counts samples since midnight.
+func (cfg Config) bextChunk(start time.Time, sampleRate float64) []byte {
+	if !cfg.BWF {
+		return nil
+	}
+	// Text fields have a fixed size and are NUL-padded.
+	field := func(b []byte, s string, size int) []byte {
+		n := len(b)
+		b = append(b, make([]byte, size)...)
+		copy(b[n:], s)
+		return b
+	}
+	midnight := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	timeRef := uint64(start.Sub(midnight).Seconds() * sampleRate)
+
+	var b []byte
+	b = field(b, cfg.Comment, 256) // Description
+	b = field(b, cfg.Artist, 32)   // Originator
+	b = field(b, "", 32)           // OriginatorReference
+	b = field(b, start.Format("2006-01-02"), 10)
+	b = field(b, start.Format("15:04:05"), 8)
+	b = binary.LittleEndian.AppendUint64(b, timeRef) // TimeReferenceLow and High
+	b = binary.LittleEndian.AppendUint16(b, 1)       // Version
+	b = field(b, "", 64)                             // UMID
+	b = field(b, "", 190)                            // Reserved
+	return appendChunk(nil, "bext", b)
+}
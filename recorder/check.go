@@ -0,0 +1,134 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Plan is what a recording with a Config would do, as found by Check.
+type Plan struct {
+	Device         string
+	Channels       int // Captured; OutputChannels are written.
+	OutputChannels int
+	SampleRate     float64 // Captured; OutputRate is written.
+	OutputRate     float64
+	BitsPerSample  int
+	SampleFormat   SampleFormat
+	Format         FileFormat
+	Output         string // The first file, or "-" for stdout.
+	Monitor        string // The monitor output device, if any.
+}
+
+func (p Plan) String() string {
+	s := fmt.Sprintf("Would record %d channels from '%s' at %.0fHz", p.Channels, p.Device, p.SampleRate)
+	if p.OutputRate != p.SampleRate {
+		s += fmt.Sprintf(", resampled to %.0fHz", p.OutputRate)
+	}
+	kind := "PCM"
+	if p.SampleFormat == Float32 {
+		kind = "float"
+	}
+	s += fmt.Sprintf(", as %d-channel %d-bit %s %s to %s", p.OutputChannels, p.BitsPerSample, kind, p.Format, p.Output)
+	if p.Monitor != "" {
+		s += fmt.Sprintf(", monitored on '%s'", p.Monitor)
+	}
+	return s
+}
+
+// Check validates cfg as NewRecorder would, without opening a stream: it
+// selects the device and sample rate, asks PortAudio whether the stream is
+// supported, looks for the encoder program of the format and makes sure the
+// output file can be created. It leaves no file behind.
+func Check(cfg Config) (Plan, error) {
+	cfg, err := validateConfig(cfg)
+	if err != nil {
+		return Plan{}, err
+	}
+	if err := ensurePortAudio(); err != nil {
+		return Plan{}, fmt.Errorf("initializing PortAudio: %w", err)
+	}
+	defer releasePortAudio()
+
+	sp, err := planStream(cfg)
+	if err != nil {
+		return Plan{}, err
+	}
+	cfg = sp.cfg
+	if err := checkEncoder(cfg.Format); err != nil {
+		return Plan{}, err
+	}
+
+	if cfg.OutputPath, err = expandPath(cfg.OutputPath, time.Now()); err != nil {
+		return Plan{}, err
+	}
+	path := cfg.OutputPath
+	if cfg.segmented() {
+		path = segmentPath(cfg, time.Now(), 1)
+	}
+	if cfg.Append {
+		t, err := openAppend(path, cfg)
+		if err != nil {
+			return Plan{}, err
+		}
+		if t != nil {
+			t.f.Close()
+			path += " (appending)"
+		}
+	} else if path != "-" {
+		if err := checkWritable(path, cfg.Overwrite); err != nil {
+			return Plan{}, err
+		}
+	}
+
+	p := Plan{
+		Device:         sp.device.Name,
+		Channels:       cfg.Channels,
+		OutputChannels: cfg.outputChannels(),
+		SampleRate:     sp.params.SampleRate,
+		OutputRate:     sp.params.SampleRate,
+		BitsPerSample:  cfg.outputBits(),
+		SampleFormat:   cfg.SampleFormat,
+		Format:         cfg.Format,
+		Output:         path,
+	}
+	if cfg.ResampleRate > 0 {
+		p.OutputRate = cfg.ResampleRate
+	}
+	if sp.params.Output.Device != nil {
+		p.Monitor = sp.params.Output.Device.Name
+	}
+	return p, nil
+}
+
+// checkWritable makes sure path could be created by CreateOutput, creating
+// and removing a temporary file in its directory, or in the closest existing
+// parent if CreateOutput would have to create the directory.
+func checkWritable(path string, overwrite bool) error {
+	if _, err := os.Stat(path); err == nil && !overwrite {
+		return fmt.Errorf("%s already exists: %w", path, fs.ErrExist)
+	}
+	dir := filepath.Dir(path)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("creating output directory: %s is not a directory", dir)
+			}
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) || filepath.Dir(dir) == dir {
+			return fmt.Errorf("creating output directory: %w", err)
+		}
+		dir = filepath.Dir(dir)
+	}
+	f, err := os.CreateTemp(dir, ".audio-grab-check-*")
+	if err != nil {
+		return fmt.Errorf("output is not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
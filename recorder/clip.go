@@ -0,0 +1,52 @@
+package recorder
+
+import "math"
+
+// inputClips counts the samples of the captured buffer at full scale, which
+// the device most likely clipped.
+func (r *Recorder) inputClips() int64 {
+	var n int64
+	switch {
+	case r.bufferF32 != nil:
+		for _, s := range r.bufferF32 {
+			if s >= 1 || s <= -1 {
+				n++
+			}
+		}
+	case r.buffer32 != nil:
+		for _, s := range r.buffer32 {
+			if s == math.MaxInt32 || s == math.MinInt32 {
+				n++
+			}
+		}
+	default:
+		for _, s := range r.buffer {
+			if s == math.MaxInt16 || s == math.MinInt16 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// checkClipping accounts the clipped samples of the buffer just written, of
+// which encodeSample clamped the given number, and warns about them at most
+// once a second of audio.
+func (r *Recorder) checkClipping(clamped int64) {
+	in := r.inputClips()
+	r.clips.input += in
+	if in+clamped == 0 || r.clips.warned && r.framesCaptured-r.clips.lastWarning < int64(r.sampleRate) {
+		return
+	}
+	r.clips.warned, r.clips.lastWarning = true, r.framesCaptured
+	logger().Warn("Clipping", "inputSamples", r.clips.input, "gainSamples", r.clips.clamped)
+}
+
+// clipCounts are the clipped samples of a recording so far. They are only
+// touched by the capture loop.
+type clipCounts struct {
+	input       int64 // At full scale in the captured buffers.
+	clamped     int64 // Clamped to full scale by encodeSample or a summing CombineMode.
+	warned      bool
+	lastWarning int64 // framesCaptured at the last warning.
+}
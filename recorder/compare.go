@@ -0,0 +1,129 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// compareSamples is the number of samples CompareWav reads at a time.
+const compareSamples = 16 << 10
+
+// WavDiff is how the sample data of two WAV files compare. Samples are
+// counted across channels, in interleaved order.
+type WavDiff struct {
+	Channels int
+	Samples  int64   // Compared, i.e. those of the shorter file.
+	Extra    int64   // Samples the second file has beyond the first; negative if it is shorter.
+	First    int64   // Index of the first sample differing by more than the tolerance, or -1.
+	MaxDiff  float64 // Largest absolute difference, normalized to full scale.
+}
+
+// Differ reports whether the files differ beyond the tolerance or in length.
+func (d WavDiff) Differ() bool {
+	return d.First >= 0 || d.Extra != 0
+}
+
+// CompareWav compares the sample data of the WAV files at a and b, which
+// must have the same sample rate, channel count and sample format. Samples
+// are normalized to full scale before they are compared, so tolerance is a
+// fraction of it, e.g. 1e-3 to allow for a lossy round trip; zero demands
+// equal samples.
+func CompareWav(a, b string, tolerance float64) (WavDiff, error) {
+	ra, err := OpenWav(a)
+	if err != nil {
+		return WavDiff{}, err
+	}
+	defer ra.Close()
+	rb, err := OpenWav(b)
+	if err != nil {
+		return WavDiff{}, err
+	}
+	defer rb.Close()
+	if ra.format.AudioFormat != rb.format.AudioFormat || ra.SampleRate() != rb.SampleRate() ||
+		ra.Channels() != rb.Channels() || ra.BitsPerSample() != rb.BitsPerSample() {
+		return WavDiff{}, fmt.Errorf("formats differ: %s holds %s, %s holds %s", a, describeWav(ra.format), b, describeWav(rb.format))
+	}
+
+	decode := sampleDecoder(ra.format)
+	size := ra.BitsPerSample() / 8
+	bufA, bufB := make([]byte, compareSamples*size), make([]byte, compareSamples*size)
+	d := WavDiff{Channels: ra.Channels(), First: -1}
+	for {
+		na, errA := io.ReadFull(ra, bufA)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return d, fmt.Errorf("%s: %w", a, errA)
+		}
+		nb, errB := io.ReadFull(rb, bufB)
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return d, fmt.Errorf("%s: %w", b, errB)
+		}
+		n := min(na, nb) / size
+		for i := range n {
+			diff := math.Abs(decode(bufA[i*size:]) - decode(bufB[i*size:]))
+			d.MaxDiff = max(d.MaxDiff, diff)
+			if diff > tolerance && d.First < 0 {
+				d.First = d.Samples + int64(i)
+			}
+		}
+		d.Samples += int64(n)
+		if na != nb {
+			// One file has ended; count what is left of the other.
+			longer, sign := io.Reader(rb), int64(1)
+			if na > nb {
+				longer, sign = ra, -1
+			}
+			rest, err := io.Copy(io.Discard, longer)
+			if err != nil {
+				return d, err
+			}
+			d.Extra = sign * ((int64(max(na, nb))+rest)/int64(size) - int64(n))
+			return d, nil
+		}
+		if errA != nil {
+			return d, nil
+		}
+	}
+}
+
+// describeWav names the layout of format for error messages.
+func describeWav(format wavFormat) string {
+	kind := "PCM"
+	switch format.AudioFormat {
+	case wavFormatIEEEFloat:
+		kind = "float"
+	case wavFormatALaw:
+		kind = "A-law"
+	case wavFormatULaw:
+		kind = "μ-law"
+	}
+	return fmt.Sprintf("%d channels of %d-bit %s at %d Hz", format.NumChannels, format.BitsPerSample, kind, format.SampleRate)
+}
+
+// sampleDecoder returns a function decoding the little-endian sample at the
+// start of a slice, in a format checkWavFormat accepts, normalized to
+// [-1, 1].
+func sampleDecoder(format wavFormat) func([]byte) float64 {
+	switch {
+	case format.AudioFormat == wavFormatALaw:
+		return func(b []byte) float64 { return int16ToFloat64(alawDecode(b[0])) }
+	case format.AudioFormat == wavFormatULaw:
+		return func(b []byte) float64 { return int16ToFloat64(ulawDecode(b[0])) }
+	case format.AudioFormat == wavFormatIEEEFloat && format.BitsPerSample == 64:
+		return func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }
+	case format.AudioFormat == wavFormatIEEEFloat:
+		return func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	case format.BitsPerSample == 8:
+		// 8-bit PCM is unsigned.
+		return func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+	case format.BitsPerSample == 16:
+		return func(b []byte) float64 { return int16ToFloat64(int16(binary.LittleEndian.Uint16(b))) }
+	case format.BitsPerSample == 24:
+		return func(b []byte) float64 {
+			return int32ToFloat64(int32(uint32(b[0])<<8 | uint32(b[1])<<16 | uint32(b[2])<<24))
+		}
+	default:
+		return func(b []byte) float64 { return int32ToFloat64(int32(binary.LittleEndian.Uint32(b))) }
+	}
+}
@@ -0,0 +1,282 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// ConfigError reports an invalid Config setting.
+type ConfigError struct {
+	Field string // Name of the Config field at fault.
+	Err   error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Field, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+// minMaxSize is the smallest Config.MaxSize accepted, leaving room for a
+// header and at least one captured buffer per file.
+const minMaxSize = 64 << 10
+
+// maxGainDB bounds Config.GainDB in either direction.
+const maxGainDB = 96
+
+// Validate checks cfg as NewRecorder would, without opening any device or
+// file. Errors are of type *ConfigError.
+func (cfg Config) Validate() error {
+	_, err := validateConfig(cfg)
+	return err
+}
+
+// latency returns the suggested latency for a device with the given
+// defaults.
+func (cfg Config) latency(low, high time.Duration) time.Duration {
+	switch {
+	case cfg.Latency > 0:
+		return cfg.Latency
+	case cfg.HighLatency:
+		return high
+	default:
+		return low
+	}
+}
+
+// lengthLimit returns the length at which a recording stops on its own, zero
+// if it runs until stopped.
+func (cfg Config) lengthLimit() time.Duration {
+	if cfg.MaxDuration > 0 && (cfg.Duration == 0 || cfg.MaxDuration < cfg.Duration) {
+		return cfg.MaxDuration
+	}
+	return cfg.Duration
+}
+
+// validateConfig checks cfg and fills in defaults: one channel, 16 bits per
+// sample (32 for float samples), framesPerBuf frames per buffer and WAV
+// output.
+func validateConfig(cfg Config) (Config, error) {
+	invalid := func(field, format string, args ...interface{}) (Config, error) {
+		return cfg, &ConfigError{Field: field, Err: fmt.Errorf(format, args...)}
+	}
+
+	if cfg.Channels == 0 {
+		cfg.Channels = 1
+		if len(cfg.ChannelMap) > 0 {
+			cfg.Channels = slices.Max(cfg.ChannelMap) + 1
+		}
+	}
+	if cfg.Channels < 1 && cfg.Channels != AllChannels {
+		return invalid("Channels", "channel count %d", cfg.Channels)
+	}
+	switch cfg.SampleFormat {
+	case PCMInt16:
+		switch cfg.BitsPerSample {
+		case 0:
+			cfg.BitsPerSample = 16
+		case 16, 24, 32:
+		default:
+			return invalid("BitsPerSample", "unsupported bits per sample %d", cfg.BitsPerSample)
+		}
+	case Float32:
+		if cfg.BitsPerSample != 0 && cfg.BitsPerSample != 32 {
+			return invalid("BitsPerSample", "float samples are 32 bits, got %d", cfg.BitsPerSample)
+		}
+		cfg.BitsPerSample = 32
+	default:
+		return invalid("SampleFormat", "unknown sample format %d", cfg.SampleFormat)
+	}
+	if cfg.OnBuffer != nil && (cfg.SampleFormat != PCMInt16 || cfg.BitsPerSample != 16) {
+		return invalid("OnBuffer", "needs 16-bit integer samples, got %d-bit", cfg.BitsPerSample)
+	}
+	if cfg.MinFree < 0 {
+		return invalid("MinFree", "minimum free space of %d bytes", cfg.MinFree)
+	}
+	if cfg.MaxDuration < 0 {
+		return invalid("MaxDuration", "maximum duration %v", cfg.MaxDuration)
+	}
+	if cfg.ReconnectTimeout < 0 {
+		return invalid("ReconnectTimeout", "reconnect timeout %v", cfg.ReconnectTimeout)
+	}
+	if cfg.Countdown < 0 {
+		return invalid("Countdown", "countdown %v", cfg.Countdown)
+	}
+	if cfg.Prebuffer < 0 {
+		return invalid("Prebuffer", "prebuffer %v", cfg.Prebuffer)
+	}
+	if cfg.OnTone != nil && cfg.ToneFrequency <= 0 {
+		return invalid("ToneFrequency", "tone frequency %v Hz", cfg.ToneFrequency)
+	}
+	if cfg.ToneThreshold > 0 {
+		return invalid("ToneThreshold", "threshold %v dBFS is above full scale", cfg.ToneThreshold)
+	}
+	if cfg.FramesPerBuffer == 0 {
+		cfg.FramesPerBuffer = framesPerBuf
+	}
+	if cfg.FramesPerBuffer < 0 {
+		return invalid("FramesPerBuffer", "buffer size of %d frames", cfg.FramesPerBuffer)
+	}
+	if cfg.Latency < 0 {
+		return invalid("Latency", "latency %v", cfg.Latency)
+	}
+	if math.Abs(cfg.GainDB) > maxGainDB {
+		return invalid("GainDB", "gain of %+.1f dB, want within ±%d dB", cfg.GainDB, maxGainDB)
+	}
+	if cfg.SampleRate < 0 {
+		return invalid("SampleRate", "sample rate %.0f Hz", cfg.SampleRate)
+	}
+	if cfg.Split < 0 || (cfg.Split > 0 && cfg.Split < time.Second) {
+		return invalid("Split", "segment length %v, want at least a second", cfg.Split)
+	}
+	if cfg.MaxSize < 0 || (cfg.MaxSize > 0 && cfg.MaxSize < minMaxSize) {
+		return invalid("MaxSize", "file size limit of %d bytes, want at least %d", cfg.MaxSize, minMaxSize)
+	}
+	if cfg.MaxSize > 0 && encoderPrograms[cfg.Format] != "" {
+		return invalid("MaxSize", "%s output cannot be split by size", cfg.Format)
+	}
+	if cfg.TrimMargin < 0 {
+		return invalid("TrimMargin", "trim margin %v", cfg.TrimMargin)
+	}
+	if cfg.NormalizeTarget > 0 {
+		return invalid("NormalizeTarget", "target of %+.1f dBFS is above full scale", cfg.NormalizeTarget)
+	}
+	if cfg.ResampleRate < 0 {
+		return invalid("ResampleRate", "sample rate %.0f Hz", cfg.ResampleRate)
+	}
+	switch cfg.Format {
+	case "":
+		cfg.Format = FormatWAV
+	case FormatWAV, FormatWAV64, FormatRaw:
+	case FormatAIFF:
+		if cfg.SampleFormat == Float32 {
+			return cfg, &ConfigError{Field: "Format", Err: errors.New("AIFF output does not support float samples")}
+		}
+	case FormatALaw, FormatULaw, FormatADPCM:
+		if cfg.SampleFormat == Float32 || cfg.BitsPerSample != 16 {
+			return invalid("Format", "%s output is coded from 16-bit integer samples only", cfg.Format)
+		}
+		if cfg.Normalize {
+			return invalid("Normalize", "%s output cannot be normalized", cfg.Format)
+		}
+		if cfg.Trim {
+			return invalid("Trim", "%s output cannot be trimmed", cfg.Format)
+		}
+	case FormatFLAC, FormatMP3, FormatOpus:
+		if cfg.SampleFormat == Float32 || cfg.BitsPerSample > 24 {
+			return invalid("Format", "%s output supports 16- and 24-bit integer samples only", cfg.Format)
+		}
+		if cfg.Format == FormatMP3 && cfg.outputChannels() > 2 {
+			return invalid("Format", "MP3 output holds one or two channels, not %d; fold them with -mix or -downmix", cfg.outputChannels())
+		}
+		if err := checkEncoder(cfg.Format); err != nil {
+			return cfg, &ConfigError{Field: "Format", Err: err}
+		}
+	default:
+		return invalid("Format", "unknown output format %q", cfg.Format)
+	}
+	if _, err := expandPath(cfg.OutputPath, time.Time{}); err != nil {
+		return cfg, &ConfigError{Field: "OutputPath", Err: err}
+	}
+	if cfg.BigEndian && cfg.Format != FormatRaw {
+		return invalid("BigEndian", "byte order is fixed by the %s format", cfg.Format)
+	}
+	if cfg.Planar {
+		switch {
+		case cfg.Format != FormatWAV:
+			return invalid("Planar", "planar output supports WAV only, not %s", cfg.Format)
+		case cfg.Mix != MixDefault:
+			return invalid("Planar", "planar output keeps every channel; it cannot be mixed as %s", cfg.Mix)
+		case cfg.segmented(), cfg.Append:
+			return invalid("Planar", "planar output cannot be split or appended to")
+		case cfg.Normalize, cfg.Trim:
+			return invalid("Planar", "planar output cannot be normalized or trimmed")
+		case cfg.ChannelMask != 0:
+			return invalid("Planar", "planar output is mono and takes no channel mask")
+		}
+	}
+	if cfg.Loopback && cfg.Monitor {
+		return invalid("Loopback", "monitoring a loopback capture would feed it back into itself")
+	}
+	if cfg.ChannelMask != 0 && cfg.Format != FormatWAV && cfg.Format != FormatWAV64 {
+		return invalid("ChannelMask", "channel masks need WAV output, not %s", cfg.Format)
+	}
+	if cfg.Append {
+		switch {
+		case cfg.Format != FormatWAV:
+			return invalid("Append", "appending supports WAV output only, not %s", cfg.Format)
+		case cfg.segmented():
+			return invalid("Append", "cannot append to a split recording")
+		case cfg.Overwrite:
+			return invalid("Append", "cannot both append to and overwrite the output")
+		case cfg.Trim:
+			return invalid("Append", "cannot trim a file being appended to")
+		}
+	}
+	switch cfg.RatePolicy {
+	case "", RateFirst, RateHighest, RateLowest, RateNearest:
+	default:
+		return invalid("RatePolicy", "unknown rate policy %q", cfg.RatePolicy)
+	}
+	switch cfg.OpusApplication {
+	case "", OpusVoIP, OpusAudio:
+	default:
+		return invalid("OpusApplication", "unknown opus application %q", cfg.OpusApplication)
+	}
+	if cfg.Bitrate < 0 {
+		return invalid("Bitrate", "bitrate %d kbps", cfg.Bitrate)
+	}
+	if cfg.Downmix != DownmixStereo && cfg.Downmix != DownmixMono {
+		return invalid("Downmix", "unknown downmix mode %d", cfg.Downmix)
+	}
+	switch cfg.Dither {
+	case "", DitherNone, DitherTPDF, DitherShaped:
+	default:
+		return invalid("Dither", "unknown dither mode %q", cfg.Dither)
+	}
+	switch cfg.Combine {
+	case "", CombineAverage, CombineSum, CombineSum3dB:
+	default:
+		return invalid("Combine", "unknown combine mode %q", cfg.Combine)
+	}
+	for _, ch := range cfg.ChannelMap {
+		if ch < 0 || (cfg.Channels != AllChannels && ch >= cfg.Channels) {
+			return invalid("ChannelMap", "channel %d of %d, counting from 0", ch, cfg.Channels)
+		}
+	}
+	if len(cfg.ChannelMap) > 0 && cfg.Mix != MixDefault {
+		return invalid("ChannelMap", "a channel map cannot be combined with mix %s", cfg.Mix)
+	}
+	switch cfg.Mix {
+	case MixDefault, MixMonoLeft, MixMonoMix, MixStereo:
+	case MixMonoRight:
+		if cfg.Channels < 2 && cfg.Channels != AllChannels {
+			return invalid("Mix", "%s needs at least two input channels", cfg.Mix)
+		}
+	default:
+		return invalid("Mix", "unknown mix mode %q", cfg.Mix)
+	}
+	for _, ch := range cfg.InvertChannels {
+		if ch < 0 || (cfg.Channels != AllChannels && ch >= cfg.Channels) {
+			return invalid("InvertChannels", "channel %d of %d, counting from 0", ch, cfg.Channels)
+		}
+	}
+	if cfg.DCBlockCutoff < 0 {
+		return invalid("DCBlockCutoff", "DC block cutoff %.1f Hz", cfg.DCBlockCutoff)
+	}
+	for i, f := range cfg.EQ {
+		if err := f.validate(); err != nil {
+			return invalid("EQ", "filter %d: %v", i+1, err)
+		}
+	}
+	if cfg.GateOpen != 0 && cfg.GateClose > cfg.GateOpen {
+		return invalid("GateClose", "gate close threshold %.1f dBFS is above open threshold %.1f dBFS", cfg.GateClose, cfg.GateOpen)
+	}
+	if cfg.LimitThreshold > 0 {
+		return invalid("LimitThreshold", "threshold of %+.1f dBFS is above full scale", cfg.LimitThreshold)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,30 @@
+package recorder
+
+import "time"
+
+// hotPeakDBFS is the peak level above which the countdown warns that the
+// input is about to clip.
+const hotPeakDBFS = -1.0
+
+// Countdown returns how much of Config.Countdown is left; zero once audio is
+// being recorded. It is safe to call while recording.
+func (r *Recorder) Countdown() time.Duration {
+	return time.Duration(float64(r.countdown.Load()) / r.sampleRate * float64(time.Second))
+}
+
+// countDown accounts the captured buffer, which has been metered but is not
+// recorded, against the countdown, warning at most once a second if its peak
+// is close to clipping.
+func (r *Recorder) countDown(level Level) {
+	frames := int64(r.numSamples() / r.cfg.Channels)
+	second := int64(r.sampleRate)
+	if level.Peak > hotPeakDBFS && (r.lastHotPeak == 0 || r.lastHotPeak-r.countdownLeft >= second) {
+		logger().Warn("Input is close to clipping; lower the gain", "peakDBFS", level.Peak)
+		r.lastHotPeak = r.countdownLeft
+	}
+	r.countdownLeft = max(0, r.countdownLeft-frames)
+	r.countdown.Store(r.countdownLeft)
+	if r.countdownLeft == 0 {
+		logger().Info("Countdown over, recording")
+	}
+}
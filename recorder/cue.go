@@ -0,0 +1,84 @@
+package recorder
+
+import "encoding/binary"
+
+// marker is a position in the current file, in frames from the start of its
+// sample data.
+type marker struct {
+	frame int64
+	label string
+}
+
+// AddMarker records the position of the most recently written frame as a cue
+// point of the current file, labelled label if it is not empty. The cue
+// points are written after the sample data when the file is finalized, in a
+// cue chunk with a LIST/adtl chunk for the labels. Only seekable WAV outputs
+// keep them. It is safe to call from any goroutine.
+func (r *Recorder) AddMarker(label string) {
+	frame := r.fileFrames.Load()
+	r.markersMu.Lock()
+	r.markers = append(r.markers, marker{frame, label})
+	n := len(r.markers)
+	r.markersMu.Unlock()
+	logger().Info("Marker added", "n", n, "frame", frame, "label", label)
+}
+
+// takeMarkers returns and forgets the markers of the current file.
+func (r *Recorder) takeMarkers() []marker {
+	r.markersMu.Lock()
+	defer r.markersMu.Unlock()
+	m := r.markers
+	r.markers = nil
+	return m
+}
+
+// shiftMarkers moves the markers of the current file back by head frames,
+// for data trimmed from its start, and keeps them within its frames.
+func (r *Recorder) shiftMarkers(head, frames int64) {
+	r.markersMu.Lock()
+	defer r.markersMu.Unlock()
+	for i := range r.markers {
+		r.markers[i].frame = min(max(0, r.markers[i].frame-head), frames)
+	}
+}
+
+// cueChunks encodes markers as a cue chunk followed, if any marker is
+// labelled, by a LIST chunk of adtl labl entries. Cue point IDs count from 1.
+func cueChunks(markers []marker) []byte {
+	cue := binary.LittleEndian.AppendUint32(nil, uint32(len(markers)))
+	var adtl []byte
+	for i, m := range markers {
+		id := uint32(i + 1)
+		cue = binary.LittleEndian.AppendUint32(cue, id)
+		cue = binary.LittleEndian.AppendUint32(cue, uint32(m.frame)) // Position.
+		cue = append(cue, "data"...)
+		cue = binary.LittleEndian.AppendUint32(cue, 0) // Chunk start.
+		cue = binary.LittleEndian.AppendUint32(cue, 0) // Block start.
+		cue = binary.LittleEndian.AppendUint32(cue, uint32(m.frame))
+		if m.label != "" {
+			labl := binary.LittleEndian.AppendUint32(nil, id)
+			labl = append(append(labl, m.label...), 0)
+			adtl = appendChunk(adtl, "labl", labl)
+		}
+	}
+	b := appendChunk(nil, "cue ", cue)
+	if adtl != nil {
+		b = appendChunk(b, "LIST", append([]byte("adtl"), adtl...))
+	}
+	return b
+}
+
+// finalizeMarkers returns the chunks to write after the sample data of the
+// current file. Markers of outputs that cannot hold them are dropped with a
+// warning.
+func (r *Recorder) finalizeMarkers() []byte {
+	markers := r.takeMarkers()
+	if len(markers) == 0 {
+		return nil
+	}
+	if r.seeker == nil || !r.cfg.Format.wav() {
+		logger().Warn("Markers dropped: they are only kept in seekable WAV files", "count", len(markers))
+		return nil
+	}
+	return cueChunks(markers)
+}
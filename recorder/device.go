@@ -0,0 +1,215 @@
+package recorder
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// direction selects whether a device is looked up for capture or playback.
+type direction int
+
+const (
+	input direction = iota
+	output
+)
+
+func (d direction) String() string {
+	if d == output {
+		return "output"
+	}
+	return "input"
+}
+
+func (d direction) maxChannels(dev *portaudio.DeviceInfo) int {
+	if d == output {
+		return dev.MaxOutputChannels
+	}
+	return dev.MaxInputChannels
+}
+
+func (d direction) defaultDevice() (*portaudio.DeviceInfo, error) {
+	if d == output {
+		return backend().DefaultOutputDevice()
+	}
+	return backend().DefaultInputDevice()
+}
+
+func (d direction) apiDefault(api *portaudio.HostApiInfo) *portaudio.DeviceInfo {
+	if d == output {
+		return api.DefaultOutputDevice
+	}
+	return api.DefaultInputDevice
+}
+
+// hostAPIs returns the host APIs of devices in order of first appearance.
+func hostAPIs(devices []*portaudio.DeviceInfo) []*portaudio.HostApiInfo {
+	var apis []*portaudio.HostApiInfo
+	for _, dev := range devices {
+		if dev.HostApi != nil && !slices.Contains(apis, dev.HostApi) {
+			apis = append(apis, dev.HostApi)
+		}
+	}
+	return apis
+}
+
+func hostAPIName(dev *portaudio.DeviceInfo) string {
+	if dev.HostApi == nil {
+		return ""
+	}
+	return dev.HostApi.Name
+}
+
+// findHostAPI returns the host API whose name contains spec, ignoring case
+// and spaces, so that "coreaudio" selects Core Audio and "wasapi" Windows
+// WASAPI.
+func findHostAPI(devices []*portaudio.DeviceInfo, spec string) (*portaudio.HostApiInfo, error) {
+	squash := func(s string) string { return strings.ReplaceAll(strings.ToLower(s), " ", "") }
+	apis := hostAPIs(devices)
+	var names []string
+	for _, api := range apis {
+		if strings.Contains(squash(api.Name), squash(spec)) {
+			return api, nil
+		}
+		names = append(names, api.Name)
+	}
+	return nil, fmt.Errorf("no host API matching %q; available: %s", spec, strings.Join(names, ", "))
+}
+
+// selectHostAPI returns the host API matching spec, or the default one if
+// spec is empty. It returns nil, meaning every device, if the backend names
+// no default.
+func selectHostAPI(devices []*portaudio.DeviceInfo, spec string) (*portaudio.HostApiInfo, error) {
+	if spec != "" {
+		return findHostAPI(devices, spec)
+	}
+	api, err := backend().DefaultHostApi()
+	if err != nil {
+		return nil, nil
+	}
+	return api, nil
+}
+
+// findDevice resolves spec against the devices of the host API matching api,
+// the default host API if api is empty. A numeric spec is taken as a device
+// index, anything else as a case-insensitive substring of the device name.
+// An empty spec selects the default device of the host API in direction d.
+// The device must offer at least the requested number of channels in that
+// direction.
+func findDevice(devices []*portaudio.DeviceInfo, api, spec string, channels int, d direction) (*portaudio.DeviceInfo, error) {
+	var dev *portaudio.DeviceInfo
+	hostAPI, err := selectHostAPI(devices, api)
+	if err != nil {
+		return nil, err
+	}
+	if hostAPI != nil {
+		all := devices
+		devices = slices.DeleteFunc(slices.Clone(devices), func(dev *portaudio.DeviceInfo) bool { return hostAPIName(dev) != hostAPI.Name })
+		if spec == "" {
+			if dev = d.apiDefault(hostAPI); dev == nil {
+				return nil, fmt.Errorf("host API %s has no default %s device\n%s", hostAPI.Name, d, listDevices(devices, channels, d))
+			}
+		} else if i, err := strconv.Atoi(spec); err == nil {
+			if j := slices.IndexFunc(all, func(dev *portaudio.DeviceInfo) bool { return dev.Index == i }); j >= 0 && hostAPIName(all[j]) != hostAPI.Name {
+				return nil, fmt.Errorf("device #%d (%s) belongs to the %s host API, not %s", i, all[j].Name, hostAPIName(all[j]), hostAPI.Name)
+			}
+		}
+	}
+	if dev == nil {
+		if dev, err = resolveDevice(devices, spec, channels, d); err != nil {
+			return nil, err
+		}
+	}
+	if d.maxChannels(dev) < channels {
+		return nil, fmt.Errorf("device #%d (%s) has %d %s channels, %d requested\n%s", dev.Index, dev.Name, d.maxChannels(dev), d, channels, listDevices(devices, channels, d))
+	}
+	return dev, nil
+}
+
+func resolveDevice(devices []*portaudio.DeviceInfo, spec string, channels int, d direction) (*portaudio.DeviceInfo, error) {
+	if spec == "" {
+		dev, err := d.defaultDevice()
+		if err != nil {
+			return nil, fmt.Errorf("%w\n%s", err, listDevices(devices, channels, d))
+		}
+		return dev, nil
+	}
+
+	if i, err := strconv.Atoi(spec); err == nil {
+		for _, dev := range devices {
+			if dev.Index == i {
+				return dev, nil
+			}
+		}
+		return nil, fmt.Errorf("device index %d out of range\n%s", i, listDevices(devices, channels, d))
+	}
+
+	name := strings.ToLower(spec)
+	for _, dev := range devices {
+		if d.maxChannels(dev) >= channels && strings.Contains(strings.ToLower(dev.Name), name) {
+			return dev, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s device matching %q\n%s", d, spec, listDevices(devices, channels, d))
+}
+
+func listDevices(devices []*portaudio.DeviceInfo, channels int, d direction) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "available %s devices:", d)
+	for _, dev := range devices {
+		if d.maxChannels(dev) >= channels {
+			fmt.Fprintf(&b, "\n  #%d: %s", dev.Index, dev.Name)
+			if api := hostAPIName(dev); api != "" {
+				fmt.Fprintf(&b, " (%s)", api)
+			}
+		}
+	}
+	return b.String()
+}
+
+// ListDevices writes the host APIs and the capabilities of every PortAudio
+// device to w. For
+// input-capable devices it also reports which candidate sample rates are
+// accepted for mono 16-bit capture. It does not open any stream.
+func ListDevices(w io.Writer) error {
+	if err := ensurePortAudio(); err != nil {
+		return err
+	}
+	defer releasePortAudio()
+
+	devices, err := backend().Devices()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "host APIs:")
+	def, _ := backend().DefaultHostApi()
+	for _, api := range hostAPIs(devices) {
+		if def != nil && def.Name == api.Name {
+			fmt.Fprintf(w, "  %s (default)\n", api.Name)
+		} else {
+			fmt.Fprintf(w, "  %s\n", api.Name)
+		}
+	}
+	for i, dev := range devices {
+		fmt.Fprintf(w, "#%d: %s\n", i, dev.Name)
+		if api := hostAPIName(dev); api != "" {
+			fmt.Fprintf(w, "    host API:         %s\n", api)
+		}
+		fmt.Fprintf(w, "    max channels:     %d in, %d out\n", dev.MaxInputChannels, dev.MaxOutputChannels)
+		fmt.Fprintf(w, "    default rate:     %.0f Hz\n", dev.DefaultSampleRate)
+		fmt.Fprintf(w, "    input latency:    %v low, %v high\n", dev.DefaultLowInputLatency, dev.DefaultHighInputLatency)
+		if dev.MaxInputChannels > 0 {
+			fmt.Fprintf(w, "    supported rates: ")
+			for _, rate := range supportedSampleRates(dev, candidateRates(dev), 1, PCMInt16, 16) {
+				fmt.Fprintf(w, " %.0f", rate)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package recorder
+
+import (
+	"testing"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// defaultAPIBackend is a FakeBackend with def as the default host API.
+type defaultAPIBackend struct {
+	*FakeBackend
+	def *portaudio.HostApiInfo
+}
+
+func (b defaultAPIBackend) DefaultHostApi() (*portaudio.HostApiInfo, error) { return b.def, nil }
+
+func TestFindDeviceHostAPI(t *testing.T) {
+	mme := &portaudio.HostApiInfo{Name: "MME"}
+	wasapi := &portaudio.HostApiInfo{Name: "Windows WASAPI"}
+	devices := []*portaudio.DeviceInfo{
+		{Index: 0, Name: "Mic (USB)", MaxInputChannels: 2, HostApi: mme},
+		{Index: 1, Name: "Mic (USB)", MaxInputChannels: 2, HostApi: wasapi},
+		{Index: 2, Name: "Line (USB)", MaxInputChannels: 2, HostApi: wasapi},
+	}
+	mme.DefaultInputDevice = devices[0]
+	wasapi.DefaultInputDevice = devices[2]
+	useFakeBackend(t, 1, 48000, nil)
+	SetBackend(defaultAPIBackend{NewFakeBackend(1, 48000, nil), mme})
+
+	tests := []struct {
+		api, spec string
+		want      int // Device index, or -1 for an error.
+	}{
+		{"", "", 0},
+		{"", "mic", 0},
+		{"", "0", 0},
+		{"", "1", -1},
+		{"", "line", -1},
+		{"wasapi", "", 2},
+		{"WASAPI", "mic", 1},
+		{"windows wasapi", "2", 2},
+		{"wasapi", "0", -1},
+		{"asio", "", -1},
+	}
+	for _, tt := range tests {
+		dev, err := findDevice(devices, tt.api, tt.spec, 1, input)
+		switch {
+		case tt.want < 0 && err == nil:
+			t.Errorf("api %q, spec %q: got device #%d, want an error", tt.api, tt.spec, dev.Index)
+		case tt.want >= 0 && err != nil:
+			t.Errorf("api %q, spec %q: %v", tt.api, tt.spec, err)
+		case tt.want >= 0 && dev.Index != tt.want:
+			t.Errorf("api %q, spec %q: got device #%d, want #%d", tt.api, tt.spec, dev.Index, tt.want)
+		}
+	}
+}
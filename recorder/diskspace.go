@@ -0,0 +1,73 @@
+package recorder
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// diskCheckInterval is how often a recording with Config.MinFree set checks
+// the free space left on the output's file system.
+const diskCheckInterval = 10 * time.Second
+
+// byteRate estimates the bytes per second written to the output. Lossless
+// encoders are assumed not to compress.
+func (r *Recorder) byteRate() float64 {
+	bitrate := r.cfg.Bitrate
+	switch r.cfg.Format {
+	case FormatMP3:
+		if bitrate == 0 {
+			bitrate = defaultMP3Bitrate
+		}
+		return float64(bitrate) * 1000 / 8
+	case FormatOpus:
+		if bitrate == 0 {
+			bitrate = defaultOpusBitrate
+		}
+		return float64(bitrate) * 1000 / 8
+	case FormatADPCM:
+		format, _ := adpcmFormat(int(r.outputRate), r.cfg.outputChannels())
+		return float64(format.ByteRate)
+	default:
+		return float64(r.cfg.outputChannels()*r.cfg.outputBits()) * r.outputRate / 8
+	}
+}
+
+// checkDiskSpace makes sure the file system of path has room for the
+// recording, if its length is known, plus Config.MinFree. Where free space
+// cannot be determined the check passes.
+func (r *Recorder) checkDiskSpace(path string) error {
+	free, ok := freeSpace(filepath.Dir(path))
+	if !ok {
+		logger().Warn("Cannot determine free disk space", "path", path)
+		return nil
+	}
+	logger().Info("Free disk space", "dir", filepath.Dir(path), "bytes", free)
+	need := uint64(r.cfg.MinFree)
+	if limit := r.cfg.lengthLimit(); limit > 0 {
+		need += uint64(limit.Seconds() * r.byteRate())
+	} else if r.cfg.MinFree > 0 {
+		logger().Warn("Recording is open-ended; it stops once free disk space falls below the minimum", "minFree", r.cfg.MinFree)
+	} else {
+		logger().Warn("Recording is open-ended and may fill the disk")
+	}
+	if free < need {
+		return fmt.Errorf("not enough disk space for %s: %d bytes free, %d needed", path, free, need)
+	}
+	return nil
+}
+
+// diskFull reports whether the output's file system has less than
+// Config.MinFree left, checking every diskCheckInterval of audio.
+func (r *Recorder) diskFull() bool {
+	if r.cfg.MinFree == 0 || r.diskPath == "" || r.framesCaptured < r.nextDiskCheck {
+		return false
+	}
+	r.nextDiskCheck = r.framesCaptured + int64(diskCheckInterval.Seconds()*r.sampleRate)
+	free, ok := freeSpace(filepath.Dir(r.diskPath))
+	if !ok || free >= uint64(r.cfg.MinFree) {
+		return false
+	}
+	logger().Warn("Stopping: free disk space fell below the minimum", "free", free, "minFree", r.cfg.MinFree)
+	return true
+}
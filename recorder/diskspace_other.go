@@ -0,0 +1,8 @@
+//go:build !unix
+
+package recorder
+
+// freeSpace is not implemented on this platform; disk space is not checked.
+func freeSpace(dir string) (uint64, bool) {
+	return 0, false
+}
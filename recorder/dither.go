@@ -0,0 +1,65 @@
+package recorder
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+// DitherMode selects the noise added before samples are quantized to a
+// shallower output depth.
+type DitherMode string
+
+const (
+	DitherNone DitherMode = "none" // Plain rounding; the default.
+	// DitherTPDF adds triangular noise of one output step either way, which
+	// turns quantization distortion into a constant, signal-independent
+	// noise floor.
+	DitherTPDF DitherMode = "tpdf"
+	// DitherShaped is DitherTPDF with first-order error feedback, which moves
+	// the noise floor towards high frequencies, where it is less audible.
+	DitherShaped DitherMode = "shaped"
+)
+
+// ditherer quantizes samples, scaled to the integer range they are encoded
+// in, to multiples of step.
+type ditherer struct {
+	step   float64
+	shaped bool
+	err    []float64 // Quantization error of the previous sample, per channel.
+	ch     int       // Channel of the next sample.
+	rng    *rand.Rand
+}
+
+func newDitherer(mode DitherMode, step float64, channels int) *ditherer {
+	return &ditherer{
+		step:   step,
+		shaped: mode == DitherShaped,
+		err:    make([]float64, channels),
+		rng:    rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+}
+
+// quantize returns v plus dither, rounded to a multiple of the step. Samples
+// must come in channel order, interleaved.
+func (d *ditherer) quantize(v float64) float64 {
+	c := d.ch
+	d.ch = (d.ch + 1) % len(d.err)
+	v -= d.err[c]
+	q := math.Round(v/d.step+d.rng.Float64()-d.rng.Float64()) * d.step
+	if d.shaped {
+		d.err[c] = q - v
+	}
+	return q
+}
+
+// captureBits is the depth of the samples the device delivers, zero for
+// float samples.
+func (r *Recorder) captureBits() int {
+	switch {
+	case r.buffer32 != nil:
+		return 32
+	case r.buffer != nil:
+		return 16
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package recorder
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// ditherErrors quantizes n samples of a slow sine spanning many steps with a
+// mono ditherer seeded for repeatability and returns the error of each
+// output sample, in steps.
+func ditherErrors(mode DitherMode, n int) []float64 {
+	const step = 256
+	d := newDitherer(mode, step, 1)
+	d.rng = rand.New(rand.NewPCG(1, 2))
+	errs := make([]float64, n)
+	for i := range errs {
+		v := 1000.37 * step * math.Sin(2*math.Pi*float64(i)/4801)
+		errs[i] = (d.quantize(v) - v) / step
+	}
+	return errs
+}
+
+// mean and rms of xs, and the rms of their sums over windows of w, which
+// weighs the noise below about 1/w of the sample rate.
+func noiseStats(xs []float64, w int) (mean, rms, lowRMS float64) {
+	var sum, sq, lowSq float64
+	for i, x := range xs {
+		sum += x
+		sq += x * x
+		if (i+1)%w == 0 {
+			var s float64
+			for _, y := range xs[i+1-w : i+1] {
+				s += y
+			}
+			lowSq += s * s
+		}
+	}
+	n := float64(len(xs))
+	return sum / n, math.Sqrt(sq / n), math.Sqrt(lowSq / float64(len(xs)/w))
+}
+
+func TestDither(t *testing.T) {
+	const n, w = 200000, 16
+	tpdfMean, tpdfRMS, tpdfLow := noiseStats(ditherErrors(DitherTPDF, n), w)
+	shapedMean, shapedRMS, shapedLow := noiseStats(ditherErrors(DitherShaped, n), w)
+
+	// Rounding adds step²/12 of noise to the step²/6 of the triangular
+	// dither, so the floor is half a step, and independent of the signal.
+	if math.Abs(tpdfMean) > 0.01 {
+		t.Errorf("TPDF error has a mean of %.4f steps, want 0", tpdfMean)
+	}
+	if math.Abs(tpdfRMS-0.5) > 0.01 {
+		t.Errorf("TPDF noise floor %.3f steps RMS, want 0.5", tpdfRMS)
+	}
+	// Window sums of independent errors grow with the square root of w.
+	if want := 0.5 * math.Sqrt(w); math.Abs(tpdfLow-want)/want > 0.05 {
+		t.Errorf("TPDF low-band noise %.3f steps RMS, want %.3f", tpdfLow, want)
+	}
+
+	// Feeding the error back differentiates it: twice the power in total,
+	// but moved to high frequencies, so window sums telescope to the
+	// difference of two errors.
+	if math.Abs(shapedMean) > 0.01 {
+		t.Errorf("shaped error has a mean of %.4f steps, want 0", shapedMean)
+	}
+	if want := 0.5 * math.Sqrt2; math.Abs(shapedRMS-want) > 0.02 {
+		t.Errorf("shaped noise floor %.3f steps RMS, want %.3f", shapedRMS, want)
+	}
+	if want := 0.5 * math.Sqrt2; math.Abs(shapedLow-want) > 0.05 {
+		t.Errorf("shaped low-band noise %.3f steps RMS, want %.3f", shapedLow, want)
+	}
+}
+
+func TestDither16Bit(t *testing.T) {
+	const frames = 48000
+	samples := make([]float64, frames)
+	for i := range samples {
+		samples[i] = pcm16(1001)
+	}
+	for _, tt := range []struct {
+		name   string
+		cfg    Config
+		mean   float64
+		spread bool // Whether the output takes several values.
+	}{
+		// Halving lands between two steps: truncation loses the half, while
+		// dither keeps it as the average.
+		{"halved", Config{Volume: 0.5}, 500, false},
+		{"halved, TPDF", Config{Volume: 0.5, Dither: DitherTPDF}, 500.5, true},
+		{"halved, shaped", Config{Volume: 0.5, Dither: DitherShaped}, 500.5, true},
+		// Untouched samples need no dither.
+		{"unchanged, TPDF", Config{Volume: 1, Dither: DitherTPDF}, 1001, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, data := readWav(t, record(t, tt.cfg, 1, frames, samples))
+			got := int16s(data)
+			var sum float64
+			for _, s := range got {
+				sum += float64(s)
+			}
+			if mean := sum / float64(len(got)); math.Abs(mean-tt.mean) > 0.02 {
+				t.Errorf("mean %.3f, want %v", mean, tt.mean)
+			}
+			if spread := slices.Min(got) != slices.Max(got); spread != tt.spread {
+				t.Errorf("samples from %d to %d", slices.Min(got), slices.Max(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package recorder
+
+import (
+	"math"
+	"time"
+)
+
+// processFrame applies the configured effects to one output frame in place,
+// before the volume is applied by writeSample.
+func (r *Recorder) processFrame(frame []float64) {
+	if r.dcBlock != nil {
+		r.dcBlock.process(frame)
+	}
+	for _, f := range r.eq {
+		f.process(frame)
+	}
+	if r.gate != nil {
+		r.gate.process(frame)
+	}
+}
+
+// defaultDCBlockCutoff is used when Config.DCBlockCutoff is zero.
+const defaultDCBlockCutoff = 20.0
+
+// dcBlocker is a first-order high-pass filter per channel,
+// y[n] = a * (y[n-1] + x[n] - x[n-1]), which removes a constant offset while
+// passing audio above the cutoff frequency.
+type dcBlocker struct {
+	a      float64
+	x1, y1 []float64 // Previous input and output per channel.
+}
+
+func newDCBlocker(cutoff, sampleRate float64, channels int) *dcBlocker {
+	rc := 1 / (2 * math.Pi * cutoff)
+	dt := 1 / sampleRate
+	return &dcBlocker{
+		a:  rc / (rc + dt),
+		x1: make([]float64, channels),
+		y1: make([]float64, channels),
+	}
+}
+
+func (d *dcBlocker) process(frame []float64) {
+	for c, x := range frame {
+		y := d.a * (d.y1[c] + x - d.x1[c])
+		d.x1[c], d.y1[c] = x, y
+		frame[c] = y
+	}
+}
+
+// gateDetectorTime is the decay time of the noise gate's level detector. It
+// bridges zero crossings so that a steady tone keeps the gate open.
+const gateDetectorTime = 10 * time.Millisecond
+
+// noiseGate mutes frames whose level is below a threshold. It opens when the
+// detected level reaches open and only closes again once the level falls
+// below close, so signals hovering around a single threshold do not make it
+// chatter. The gain moves towards its target with the attack coefficient
+// when opening and the release coefficient when closing.
+type noiseGate struct {
+	open, close     float64 // Linear thresholds.
+	attack, release float64 // Per-frame smoothing coefficients.
+	decay           float64 // Per-frame detector decay.
+
+	env    float64
+	isOpen bool
+	gain   float64
+}
+
+func newNoiseGate(openDBFS, closeDBFS float64, attack, release time.Duration, sampleRate float64) *noiseGate {
+	return &noiseGate{
+		open:    fromDBFS(openDBFS),
+		close:   fromDBFS(closeDBFS),
+		attack:  smoothingCoefficient(attack, sampleRate),
+		release: smoothingCoefficient(release, sampleRate),
+		decay:   1 - smoothingCoefficient(gateDetectorTime, sampleRate),
+	}
+}
+
+func (g *noiseGate) process(frame []float64) {
+	peak := 0.0
+	for _, s := range frame {
+		peak = math.Max(peak, math.Abs(s))
+	}
+	g.env = math.Max(peak, g.env*g.decay)
+
+	if !g.isOpen && g.env >= g.open {
+		g.isOpen = true
+	} else if g.isOpen && g.env < g.close {
+		g.isOpen = false
+	}
+
+	if g.isOpen {
+		g.gain += (1 - g.gain) * g.attack
+	} else {
+		g.gain -= g.gain * g.release
+	}
+	for i := range frame {
+		frame[i] *= g.gain
+	}
+}
+
+// smoothingCoefficient returns the per-frame coefficient of a one-pole
+// smoother with time constant d. A zero duration switches immediately.
+func smoothingCoefficient(d time.Duration, sampleRate float64) float64 {
+	if d <= 0 {
+		return 1
+	}
+	return 1 - math.Exp(-1/(d.Seconds()*sampleRate))
+}
+
+// fromDBFS converts a dBFS level to a normalized amplitude.
+func fromDBFS(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+const (
+	// limiterLookahead is how far the limiter looks ahead, and so how much
+	// it delays the output, to reduce the gain before a peak arrives.
+	limiterLookahead = 5 * time.Millisecond
+	// limiterKnee is the width in dB of the soft knee centred on the
+	// threshold.
+	limiterKnee = 6.0
+)
+
+// limiter keeps frames below a threshold by attenuating only the peaks that
+// would exceed it. Each frame's target gain follows a soft knee. The
+// minimum target over the lookahead window is released with a one-pole
+// smoother and then averaged over the window, so the gain ramps down ahead
+// of a peak and is at most the peak's target by the time the delayed frame
+// is output, without the flat tops of clipping. Channels are limited
+// together.
+type limiter struct {
+	threshold float64 // dBFS.
+	release   float64 // Per-frame smoothing coefficient.
+
+	delay   [][]float64 // Ring of the last n input frames.
+	targets []float64   // Ring of their target gains.
+	gains   []float64   // Ring of released gains, summed in sum.
+	pos     int
+	sum     float64
+	gain    float64
+	out     []float64
+}
+
+func newLimiter(thresholdDBFS float64, release time.Duration, sampleRate float64, channels int) *limiter {
+	n := max(1, int(limiterLookahead.Seconds()*sampleRate))
+	l := &limiter{
+		threshold: thresholdDBFS,
+		release:   smoothingCoefficient(release, sampleRate),
+		delay:     make([][]float64, n),
+		targets:   make([]float64, n),
+		gains:     make([]float64, n),
+		sum:       float64(n),
+		gain:      1,
+		out:       make([]float64, channels),
+	}
+	for i := range l.delay {
+		l.delay[i] = make([]float64, channels)
+		l.targets[i] = 1
+		l.gains[i] = 1
+	}
+	return l
+}
+
+// process takes one frame with gain applied and returns the limited frame
+// from limiterLookahead earlier. The returned slice is reused by the next
+// call.
+func (l *limiter) process(frame []float64, gain float64) []float64 {
+	peak := 0.0
+	for _, s := range frame {
+		peak = math.Max(peak, math.Abs(s*gain))
+	}
+
+	// The oldest frame leaves the delay line with the mean of the released
+	// gains of the last n frames, each of which covered its target.
+	oldest := l.delay[l.pos]
+	g := l.sum / float64(len(l.gains))
+	for c, s := range oldest {
+		l.out[c] = s * g
+	}
+	for c, s := range frame {
+		oldest[c] = s * gain
+	}
+	l.targets[l.pos] = l.targetGain(peak)
+
+	minTarget := 1.0
+	for _, t := range l.targets {
+		minTarget = math.Min(minTarget, t)
+	}
+	if minTarget < l.gain {
+		l.gain = minTarget
+	} else {
+		l.gain += (minTarget - l.gain) * l.release
+	}
+	l.sum += l.gain - l.gains[l.pos]
+	l.gains[l.pos] = l.gain
+	l.pos = (l.pos + 1) % len(l.delay)
+	return l.out
+}
+
+// targetGain returns the gain that brings a peak to the soft-knee limiter
+// curve: unchanged below the knee, the threshold above it and a quadratic
+// blend in between, which never exceeds the threshold.
+func (l *limiter) targetGain(peak float64) float64 {
+	if peak == 0 {
+		return 1
+	}
+	x := 20 * math.Log10(peak)
+	var y float64
+	switch over := x - l.threshold; {
+	case over <= -limiterKnee/2:
+		return 1
+	case over >= limiterKnee/2:
+		y = l.threshold
+	default:
+		y = x - (over+limiterKnee/2)*(over+limiterKnee/2)/(2*limiterKnee)
+	}
+	return fromDBFS(y - x)
+}
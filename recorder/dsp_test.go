@@ -0,0 +1,90 @@
+package recorder
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNoiseGateHysteresis(t *testing.T) {
+	// Switched without smoothing, so the gain is 0 or 1.
+	g := newNoiseGate(-30, -50, 0, 0, 48000)
+	for _, step := range []struct {
+		name   string
+		level  float64
+		frames int
+		open   bool // Throughout the step, or if not by its end.
+	}{
+		{"below close", 0.001, 480, false},
+		{"between, closed", 0.01, 4800, false},
+		{"above open", 0.1, 480, true},
+		{"between, open", 0.01, 4800, true},
+		{"below close again", 0.001, 4800, false},
+	} {
+		var out float64
+		for i := range step.frames {
+			frame := []float64{step.level}
+			g.process(frame)
+			out = frame[0]
+			if step.open && out != step.level {
+				t.Fatalf("%s: frame %d gated", step.name, i)
+			}
+		}
+		if !step.open && out != 0 {
+			t.Errorf("%s: still open after %d frames", step.name, step.frames)
+		}
+	}
+}
+
+func TestDCBlocker(t *testing.T) {
+	offsets := []float64{0.2, -0.1}
+	d := newDCBlocker(defaultDCBlockCutoff, 48000, len(offsets))
+	// A second of a 1 kHz tone on each offset, in 100ms windows.
+	means := make([][]float64, 10)
+	for w := range means {
+		sums := make([]float64, len(offsets))
+		for i := range 4800 {
+			tone := 0.3 * math.Sin(2*math.Pi*1000*float64(w*4800+i)/48000)
+			frame := []float64{offsets[0] + tone, offsets[1] + tone}
+			d.process(frame)
+			for c, s := range frame {
+				sums[c] += s
+			}
+		}
+		for c := range sums {
+			means[w] = append(means[w], sums[c]/4800)
+		}
+	}
+	for c, off := range offsets {
+		if m := means[0][c]; math.Abs(m) < math.Abs(off)/100 {
+			t.Errorf("channel %d: mean %.4f over the first window, want the offset decaying from %v", c, m, off)
+		}
+		if m := means[len(means)-1][c]; math.Abs(m) > 1e-4 {
+			t.Errorf("channel %d: mean %.2g after a second, want near 0", c, m)
+		}
+	}
+}
+
+func TestLimiterPeak(t *testing.T) {
+	const threshold = -6.0
+	l := newLimiter(threshold, 50*time.Millisecond, 48000, 2)
+	limit := fromDBFS(threshold)
+	peak := 0.0
+	// Quiet, then a burst far above the threshold with gain, then quiet.
+	for i := range 48000 {
+		s := 0.1 * math.Sin(2*math.Pi*440*float64(i)/48000)
+		if i >= 12000 && i < 24000 {
+			s *= 9
+		}
+		for _, out := range l.process([]float64{s, -s / 2}, 2) {
+			peak = math.Max(peak, math.Abs(out))
+		}
+	}
+	// Allowing for the rounding of the running gain sum.
+	if peak > limit+1e-9 {
+		t.Errorf("output peaks at %.2f dBFS, above the %v dBFS threshold", toDBFS(peak), threshold)
+	}
+	if peak < limit/2 {
+		t.Errorf("output peaks at %.2f dBFS, limited far below the threshold", toDBFS(peak))
+	}
+}
@@ -0,0 +1,174 @@
+package recorder
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// externalEncoder pipes raw little-endian PCM into an encoder program that
+// writes the compressed stream to the Recorder's output. Samples reach the
+// encoder buffer by buffer as they are captured.
+type externalEncoder struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+// startEncoder runs name with args, feeding it from the returned encoder and
+// sending its standard output to out.
+func startEncoder(out io.Writer, name string, args ...string) (*externalEncoder, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s encoder not available: %w", name, err)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting %s: %w", name, err)
+	}
+	return &externalEncoder{cmd: cmd, stdin: stdin}, nil
+}
+
+func (e *externalEncoder) Write(p []byte) (int, error) {
+	return e.stdin.Write(p)
+}
+
+// Close signals the end of the input and waits for the encoder to flush its
+// output and exit.
+func (e *externalEncoder) Close() error {
+	if err := e.stdin.Close(); err != nil {
+		e.cmd.Wait()
+		return err
+	}
+	if err := e.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s: %w", e.cmd.Path, err)
+	}
+	return nil
+}
+
+// encoderPrograms names the external program each encoded format needs.
+//
+// Opus goes through opusenc like the other formats rather than an in-process
+// encoder. The Go bindings, such as hraban/opus, wrap libopus and libopusfile
+// with cgo, so every build of the package would need their headers even if it
+// never writes Opus, and the pure-Go ports lack the Ogg muxing and
+// resampling opusenc does.
+var encoderPrograms = map[FileFormat]string{
+	FormatFLAC: "flac",
+	FormatMP3:  "lame",
+	FormatOpus: "opusenc",
+}
+
+// encoderPackages names the Debian package providing each encoder program.
+var encoderPackages = map[string]string{
+	"flac":    "flac",
+	"lame":    "lame",
+	"opusenc": "opus-tools",
+}
+
+// checkEncoder reports a descriptive error when the program format needs is
+// not installed, so that the problem surfaces before any stream is opened.
+func checkEncoder(format FileFormat) error {
+	name, ok := encoderPrograms[format]
+	if !ok {
+		return nil
+	}
+	if _, err := exec.LookPath(name); err != nil {
+		return fmt.Errorf("%s output needs the %s program, which is not on PATH; install it, e.g. with the %s package", format, name, encoderPackages[name])
+	}
+	return nil
+}
+
+// startFLACEncoder starts the reference flac command line encoder on raw
+// input in the Recorder's output layout.
+func (r *Recorder) startFLACEncoder() (*externalEncoder, error) {
+	return startEncoder(r.out, "flac",
+		"--silent",
+		"--force-raw-format",
+		"--endian=little",
+		"--sign=signed",
+		"--channels="+strconv.Itoa(r.cfg.outputChannels()),
+		"--bps="+strconv.Itoa(r.cfg.BitsPerSample),
+		"--sample-rate="+strconv.Itoa(int(r.outputRate)),
+		"--stdout",
+		"-",
+	)
+}
+
+// defaultMP3Bitrate is used when Config.Bitrate is zero.
+const defaultMP3Bitrate = 128
+
+// startMP3Encoder starts the lame MP3 encoder on raw input in the Recorder's
+// output layout, using joint stereo for two channels and mono otherwise.
+func (r *Recorder) startMP3Encoder() (*externalEncoder, error) {
+	mode := "m"
+	if r.cfg.outputChannels() == 2 {
+		mode = "j"
+	}
+	bitrate := r.cfg.Bitrate
+	if bitrate == 0 {
+		bitrate = defaultMP3Bitrate
+	}
+	return startEncoder(r.out, "lame",
+		"--quiet",
+		"-r",
+		"-s", strconv.FormatFloat(r.outputRate/1000, 'f', -1, 64),
+		"--bitwidth", strconv.Itoa(r.cfg.BitsPerSample),
+		"--signed",
+		"--little-endian",
+		"-m", mode,
+		"-b", strconv.Itoa(bitrate),
+		"-",
+		"-",
+	)
+}
+
+const (
+	// defaultOpusBitrate is used when Config.Bitrate is zero; it suits speech.
+	defaultOpusBitrate = 24
+	// opusFrameMillis is the Opus frame duration.
+	opusFrameMillis = 20
+)
+
+// Opus applications selectable with Config.OpusApplication.
+const (
+	OpusVoIP  = "voip"
+	OpusAudio = "audio"
+)
+
+// startOpusEncoder starts opusenc on raw input in the Recorder's output
+// layout, producing an Ogg/Opus stream. opusenc cuts the incoming buffers into
+// fixed opusFrameMillis frames and resamples to the 48 kHz Opus works at
+// internally, so any capture rate can be fed to it; it finalizes the Ogg
+// stream once its input is closed.
+func (r *Recorder) startOpusEncoder() (*externalEncoder, error) {
+	tuning := "--speech"
+	if r.cfg.OpusApplication == OpusAudio {
+		tuning = "--music"
+	}
+	bitrate := r.cfg.Bitrate
+	if bitrate == 0 {
+		bitrate = defaultOpusBitrate
+	}
+	return startEncoder(r.out, "opusenc",
+		"--quiet",
+		"--raw",
+		"--raw-bits", strconv.Itoa(r.cfg.BitsPerSample),
+		"--raw-rate", strconv.Itoa(int(r.outputRate)),
+		"--raw-chan", strconv.Itoa(r.cfg.outputChannels()),
+		"--raw-endianness", "0",
+		"--bitrate", strconv.Itoa(bitrate),
+		"--framesize", strconv.Itoa(opusFrameMillis),
+		tuning,
+		"-",
+		"-",
+	)
+}
@@ -0,0 +1,79 @@
+package recorder
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMissingEncoder(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	_, err := validateConfig(Config{Format: FormatOpus, Volume: 1})
+	var ce *ConfigError
+	if !errors.As(err, &ce) || ce.Field != "Format" {
+		t.Fatalf("got %v, want a ConfigError for Format", err)
+	}
+	if !strings.Contains(err.Error(), "opusenc") || !strings.Contains(err.Error(), "opus-tools") {
+		t.Errorf("%q names neither the program nor its package", err)
+	}
+}
+
+func TestFLACRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("flac"); err != nil {
+		t.Skip("flac is not on PATH")
+	}
+	const frames = 4800
+	var samples []float64
+	for i := range frames {
+		s := 0.5 * math.Sin(2*math.Pi*440*float64(i)/48000)
+		samples = append(samples, s, -s/3)
+	}
+	want := record(t, Config{Channels: 2, Format: FormatRaw}, 2, frames, samples)
+	encoded := record(t, Config{Channels: 2, Format: FormatFLAC}, 2, frames, samples)
+	if string(encoded[:4]) != "fLaC" {
+		t.Fatalf("output starts %q, want a FLAC stream", encoded[:4])
+	}
+
+	cmd := exec.Command("flac", "--silent", "--decode", "--force-raw-format", "--endian=little", "--sign=signed", "--stdout", "-")
+	cmd.Stdin = bytes.NewReader(encoded)
+	got, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("decoded %d bytes differing from the %d bytes of PCM recorded", len(got), len(want))
+	}
+}
+
+func TestMP3Channels(t *testing.T) {
+	// Only the presence of lame is checked.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "lame"), nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	for _, tt := range []struct {
+		cfg Config
+		ok  bool
+	}{
+		{Config{Channels: 2}, true},
+		{Config{Channels: 6}, true}, // Downmixed to stereo.
+		{Config{Channels: 3, ChannelMap: []int{0, 1, 2}}, false},
+		{Config{Channels: 4, ChannelMap: []int{3, 2, 1, 0}}, false},
+	} {
+		tt.cfg.Format, tt.cfg.Volume = FormatMP3, 1
+		_, err := validateConfig(tt.cfg)
+		var ce *ConfigError
+		switch {
+		case tt.ok && err != nil:
+			t.Errorf("%d channels mapped %v: %v", tt.cfg.Channels, tt.cfg.ChannelMap, err)
+		case !tt.ok && (!errors.As(err, &ce) || ce.Field != "Format" || !strings.Contains(err.Error(), "one or two channels")):
+			t.Errorf("%d channels mapped %v: got %v, want a ConfigError for the channel count", tt.cfg.Channels, tt.cfg.ChannelMap, err)
+		}
+	}
+}
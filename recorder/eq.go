@@ -0,0 +1,106 @@
+package recorder
+
+import (
+	"fmt"
+	"math"
+)
+
+// FilterType selects the response of an EQ filter.
+type FilterType string
+
+const (
+	FilterLowPass   FilterType = "lowpass"
+	FilterHighPass  FilterType = "highpass"
+	FilterPeaking   FilterType = "peaking"
+	FilterLowShelf  FilterType = "lowshelf"
+	FilterHighShelf FilterType = "highshelf"
+)
+
+// defaultFilterQ is used when Filter.Q is zero; it gives pass filters a
+// Butterworth response.
+const defaultFilterQ = 1 / math.Sqrt2
+
+// Filter is one stage of Config.EQ. GainDB only applies to peaking and shelf
+// filters.
+type Filter struct {
+	Type   FilterType
+	Freq   float64 // Cutoff, centre or shelf midpoint in Hz.
+	GainDB float64
+	Q      float64 // Zero means defaultFilterQ.
+}
+
+func (f Filter) validate() error {
+	switch f.Type {
+	case FilterLowPass, FilterHighPass, FilterPeaking, FilterLowShelf, FilterHighShelf:
+	default:
+		return fmt.Errorf("unknown filter type %q", f.Type)
+	}
+	if f.Freq <= 0 {
+		return fmt.Errorf("%s filter at %.1f Hz", f.Type, f.Freq)
+	}
+	if f.Q < 0 {
+		return fmt.Errorf("%s filter with Q %.2f", f.Type, f.Q)
+	}
+	return nil
+}
+
+// biquad is a second-order IIR filter with the coefficients of the RBJ audio
+// EQ cookbook, normalized by a0, run in transposed direct form II with state
+// per channel.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             []float64
+}
+
+func newBiquad(f Filter, sampleRate float64, channels int) *biquad {
+	q := f.Q
+	if q == 0 {
+		q = defaultFilterQ
+	}
+	a := math.Pow(10, f.GainDB/40)
+	w0 := 2 * math.Pi * f.Freq / sampleRate
+	cos, alpha := math.Cos(w0), math.Sin(w0)/(2*q)
+	shelf := 2 * math.Sqrt(a) * alpha
+
+	var b0, b1, b2, a0, a1, a2 float64
+	switch f.Type {
+	case FilterLowPass:
+		b0, b1, b2 = (1-cos)/2, 1-cos, (1-cos)/2
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case FilterHighPass:
+		b0, b1, b2 = (1+cos)/2, -(1 + cos), (1+cos)/2
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case FilterPeaking:
+		b0, b1, b2 = 1+alpha*a, -2*cos, 1-alpha*a
+		a0, a1, a2 = 1+alpha/a, -2*cos, 1-alpha/a
+	case FilterLowShelf:
+		b0 = a * ((a + 1) - (a-1)*cos + shelf)
+		b1 = 2 * a * ((a - 1) - (a+1)*cos)
+		b2 = a * ((a + 1) - (a-1)*cos - shelf)
+		a0 = (a + 1) + (a-1)*cos + shelf
+		a1 = -2 * ((a - 1) + (a+1)*cos)
+		a2 = (a + 1) + (a-1)*cos - shelf
+	case FilterHighShelf:
+		b0 = a * ((a + 1) + (a-1)*cos + shelf)
+		b1 = -2 * a * ((a - 1) + (a+1)*cos)
+		b2 = a * ((a + 1) + (a-1)*cos - shelf)
+		a0 = (a + 1) - (a-1)*cos + shelf
+		a1 = 2 * ((a - 1) - (a+1)*cos)
+		a2 = (a + 1) - (a-1)*cos - shelf
+	}
+	return &biquad{
+		b0: b0 / a0, b1: b1 / a0, b2: b2 / a0,
+		a1: a1 / a0, a2: a2 / a0,
+		z1: make([]float64, channels),
+		z2: make([]float64, channels),
+	}
+}
+
+func (f *biquad) process(frame []float64) {
+	for c, x := range frame {
+		y := f.b0*x + f.z1[c]
+		f.z1[c] = f.b1*x - f.a1*y + f.z2[c]
+		f.z2[c] = f.b2*x - f.a2*y
+		frame[c] = y
+	}
+}
@@ -0,0 +1,39 @@
+package recorder
+
+import (
+	"math"
+	"testing"
+)
+
+// filterGain returns the gain in dB of f on a sine of freq Hz at 48 kHz,
+// once the filter has settled.
+func filterGain(f Filter, freq float64) float64 {
+	const rate = 48000
+	bq := newBiquad(f, rate, 1)
+	var in, out float64
+	for i := range rate {
+		x := math.Sin(2 * math.Pi * freq * float64(i) / rate)
+		frame := []float64{x}
+		bq.process(frame)
+		if i >= rate/2 {
+			in += x * x
+			out += frame[0] * frame[0]
+		}
+	}
+	return 10 * math.Log10(out/in)
+}
+
+func TestPeakingFilter(t *testing.T) {
+	for _, gain := range []float64{6, -9, 12} {
+		f := Filter{Type: FilterPeaking, Freq: 1000, GainDB: gain, Q: 1}
+		if got := filterGain(f, 1000); math.Abs(got-gain) > 0.05 {
+			t.Errorf("%+v dB peak: %.2f dB at the centre frequency", gain, got)
+		}
+		// Decades away the response is nearly flat.
+		for _, freq := range []float64{20, 20000} {
+			if got := filterGain(f, freq); math.Abs(got) > math.Abs(gain)/10 {
+				t.Errorf("%+v dB peak: %.2f dB at %v Hz", gain, got, freq)
+			}
+		}
+	}
+}
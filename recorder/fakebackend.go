@@ -0,0 +1,192 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// FakeBackend is an AudioBackend for tests, with one input and one output
+// device and no hardware behind them. The input captures Samples, which are
+// interleaved and normalized to [-1, 1], followed by silence; reads return
+// at once instead of at the sample rate, so recordings should set
+// Config.Duration. Audio written to the output is discarded. Only the
+// device's default sample rate is supported.
+type FakeBackend struct {
+	Samples []float64
+
+	input, output *portaudio.DeviceInfo
+	pos           int
+	gen           func(frame int64) float64 // Replaces Samples if set.
+}
+
+// NewFakeBackend returns a FakeBackend whose input has the given number of
+// channels and sample rate.
+func NewFakeBackend(channels int, sampleRate float64, samples []float64) *FakeBackend {
+	api := &portaudio.HostApiInfo{Name: "Fake"}
+	b := &FakeBackend{
+		Samples: samples,
+		input: &portaudio.DeviceInfo{
+			Index:             0,
+			Name:              "Fake input",
+			MaxInputChannels:  channels,
+			DefaultSampleRate: sampleRate,
+			HostApi:           api,
+		},
+		output: &portaudio.DeviceInfo{
+			Index:             1,
+			Name:              "Fake output",
+			MaxOutputChannels: 2,
+			DefaultSampleRate: sampleRate,
+			HostApi:           api,
+		},
+	}
+	api.Devices = []*portaudio.DeviceInfo{b.input, b.output}
+	api.DefaultInputDevice, api.DefaultOutputDevice = b.input, b.output
+	return b
+}
+
+func (b *FakeBackend) Initialize() error { return nil }
+func (b *FakeBackend) Terminate() error  { return nil }
+
+func (b *FakeBackend) Devices() ([]*portaudio.DeviceInfo, error) {
+	return []*portaudio.DeviceInfo{b.input, b.output}, nil
+}
+
+func (b *FakeBackend) DefaultInputDevice() (*portaudio.DeviceInfo, error)  { return b.input, nil }
+func (b *FakeBackend) DefaultOutputDevice() (*portaudio.DeviceInfo, error) { return b.output, nil }
+func (b *FakeBackend) DefaultHostApi() (*portaudio.HostApiInfo, error)     { return b.input.HostApi, nil }
+
+func (b *FakeBackend) IsFormatSupported(p portaudio.StreamParameters, buffers ...interface{}) error {
+	if p.Input.Device != nil && (p.Input.Device != b.input || p.Input.Channels > b.input.MaxInputChannels) {
+		return portaudio.InvalidChannelCount
+	}
+	if p.Output.Device != nil && (p.Output.Device != b.output || p.Output.Channels > b.output.MaxOutputChannels) {
+		return portaudio.InvalidChannelCount
+	}
+	if p.SampleRate != b.input.DefaultSampleRate {
+		return portaudio.InvalidSampleRate
+	}
+	return nil
+}
+
+func (b *FakeBackend) OpenStream(p portaudio.StreamParameters, buffers ...interface{}) (Stream, error) {
+	if err := b.IsFormatSupported(p, buffers...); err != nil {
+		return nil, err
+	}
+	s := &fakeStream{
+		fill:   b.next,
+		info:   portaudio.StreamInfo{InputLatency: p.Input.Latency, OutputLatency: p.Output.Latency, SampleRate: p.SampleRate},
+		opened: time.Now(),
+	}
+	if p.Input.Device != nil {
+		s.in = buffers[0]
+	}
+	return s, nil
+}
+
+// next returns the next captured sample.
+func (b *FakeBackend) next() float64 {
+	if b.gen != nil {
+		frame := int64(b.pos / b.input.MaxInputChannels)
+		b.pos++
+		return b.gen(frame)
+	}
+	if b.pos >= len(b.Samples) {
+		return 0
+	}
+	b.pos++
+	return b.Samples[b.pos-1]
+}
+
+// errStreamClosed is returned by fake streams used after Close.
+var errStreamClosed = errors.New("stream closed")
+
+// fakeStream fills its input buffer with samples from fill.
+type fakeStream struct {
+	in     interface{}
+	fill   func() float64
+	info   portaudio.StreamInfo
+	opened time.Time
+	closed bool
+}
+
+func (s *fakeStream) Start() error { return s.check() }
+func (s *fakeStream) Stop() error  { return s.check() }
+func (s *fakeStream) Write() error { return s.check() }
+
+func (s *fakeStream) Info() *portaudio.StreamInfo { return &s.info }
+func (s *fakeStream) Time() time.Duration         { return time.Since(s.opened) }
+
+func (s *fakeStream) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *fakeStream) check() error {
+	if s.closed {
+		return errStreamClosed
+	}
+	return nil
+}
+
+func (s *fakeStream) Read() error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	switch buf := s.in.(type) {
+	case []int16:
+		for i := range buf {
+			buf[i] = clampInt16(s.fill() * math.MaxInt16)
+		}
+	case []int32:
+		for i := range buf {
+			buf[i] = clampInt32(s.fill() * math.MaxInt32)
+		}
+	case []float32:
+		for i := range buf {
+			buf[i] = float32(s.fill())
+		}
+	}
+	return nil
+}
+
+// toneAmplitude is the peak of generated test signals, -6 dBFS.
+const toneAmplitude = 0.5
+
+// NewToneBackend returns a FakeBackend whose input captures an endless sine
+// wave of freq Hz at -6 dBFS on every channel.
+func NewToneBackend(channels int, sampleRate, freq float64) *FakeBackend {
+	b := NewFakeBackend(channels, sampleRate, nil)
+	w := 2 * math.Pi * freq / sampleRate
+	b.gen = func(frame int64) float64 {
+		return toneAmplitude * math.Sin(w*float64(frame))
+	}
+	b.input.Name = fmt.Sprintf("Tone %.0f Hz", freq)
+	return b
+}
+
+// NewSweepBackend is like NewToneBackend but sweeps exponentially from low
+// to high Hz over length, then holds high.
+func NewSweepBackend(channels int, sampleRate, low, high float64, length time.Duration) *FakeBackend {
+	if low == high {
+		return NewToneBackend(channels, sampleRate, low)
+	}
+	b := NewFakeBackend(channels, sampleRate, nil)
+	n := length.Seconds() * sampleRate
+	k := math.Log(high / low)
+	// The phase is the integral of low*(high/low)^(t/length).
+	end := 2 * math.Pi * low / sampleRate * n / k * (math.Exp(k) - 1)
+	b.gen = func(frame int64) float64 {
+		i := float64(frame)
+		if i >= n {
+			return toneAmplitude * math.Sin(end+2*math.Pi*high/sampleRate*(i-n))
+		}
+		return toneAmplitude * math.Sin(2*math.Pi*low/sampleRate*n/k*(math.Exp(k*i/n)-1))
+	}
+	b.input.Name = fmt.Sprintf("Sweep %.0f-%.0f Hz", low, high)
+	return b
+}
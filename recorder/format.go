@@ -0,0 +1,194 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileFormat selects the container a Recorder writes around the sample data.
+type FileFormat string
+
+const (
+	// FormatWAV writes a RIFF/WAVE file.
+	FormatWAV FileFormat = "wav"
+	// FormatWAV64 writes a RIFF/WAVE file that becomes an RF64 file, with
+	// 64-bit sizes, should the data outgrow the 4 GiB of a plain one.
+	FormatWAV64 FileFormat = "wav64"
+	// FormatRaw writes headerless interleaved little-endian samples.
+	FormatRaw FileFormat = "raw"
+	// FormatAIFF writes an AIFF file with big-endian integer samples.
+	FormatAIFF FileFormat = "aiff"
+	// FormatFLAC encodes losslessly with the external flac program.
+	FormatFLAC FileFormat = "flac"
+	// FormatMP3 encodes lossily with the external lame program.
+	FormatMP3 FileFormat = "mp3"
+	// FormatOpus encodes an Ogg/Opus stream with the external opusenc program.
+	FormatOpus FileFormat = "opus"
+	// FormatALaw writes a WAV file of 8-bit G.711 A-law samples, companded
+	// from 16-bit capture.
+	FormatALaw FileFormat = "alaw"
+	// FormatULaw writes a WAV file of 8-bit G.711 μ-law samples, companded
+	// from 16-bit capture.
+	FormatULaw FileFormat = "ulaw"
+	// FormatADPCM writes a WAV file of 4-bit IMA ADPCM samples, coded from
+	// 16-bit capture.
+	FormatADPCM FileFormat = "adpcm"
+)
+
+// wav reports whether the format is written in a WAV container.
+func (f FileFormat) wav() bool {
+	return f == FormatWAV || f == FormatWAV64 || f.coded()
+}
+
+// coded reports whether the samples of the format are coded from 16-bit
+// capture rather than written as linear samples.
+func (f FileFormat) coded() bool {
+	return f == FormatALaw || f == FormatULaw || f == FormatADPCM
+}
+
+// FormatForPath returns the output format implied by the extension of path.
+// Paths without an extension get FormatWAV.
+func FormatForPath(path string) (FileFormat, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case "", ".wav":
+		return FormatWAV, nil
+	case ".rf64", ".bw64":
+		return FormatWAV64, nil
+	case ".raw", ".pcm":
+		return FormatRaw, nil
+	case ".aif", ".aiff":
+		return FormatAIFF, nil
+	case ".flac":
+		return FormatFLAC, nil
+	case ".mp3":
+		return FormatMP3, nil
+	case ".opus", ".ogg":
+		return FormatOpus, nil
+	default:
+		return "", fmt.Errorf("unsupported output format %q", ext)
+	}
+}
+
+// writeHeader writes whatever precedes the sample data in the output format.
+func (r *Recorder) writeHeader() error {
+	if r.planar != nil {
+		return r.planar.writeHeaders(r)
+	}
+	dataSize := uint32(0)
+	if r.seeker == nil {
+		dataSize = unknownDataSize
+	}
+	switch r.cfg.Format {
+	case FormatRaw:
+		return nil
+	case FormatFLAC:
+		return r.startEncoder(r.startFLACEncoder)
+	case FormatMP3:
+		return r.startEncoder(r.startMP3Encoder)
+	case FormatOpus:
+		return r.startEncoder(r.startOpusEncoder)
+	case FormatAIFF:
+		return writeAiffHeader(r.out, int(r.outputRate), r.cfg.outputChannels(), r.cfg.BitsPerSample, dataSize)
+	case FormatADPCM:
+		if r.adpcm == nil {
+			r.adpcm = newADPCMEncoder(r.cfg.outputChannels(), r.outputRate)
+		}
+		format, ext := adpcmFormat(int(r.outputRate), r.cfg.outputChannels())
+		layout, err := writeWavHeaderFormat(r.out, format, ext, r.adpcm.perBlock, dataSize, r.wavChunks())
+		r.wavLayout = layout
+		return err
+	case FormatWAV, FormatWAV64:
+		format, ext := pcmFormat(r.cfg.wavFormatTag(), int(r.outputRate), r.cfg.outputChannels(), r.cfg.outputBits()), []byte(nil)
+		if r.cfg.extensible() {
+			mask := r.cfg.ChannelMask
+			if mask == 0 {
+				mask = DefaultChannelMask(r.cfg.outputChannels())
+			}
+			format, ext = extensibleFormat(r.cfg.wavFormatTag(), int(r.outputRate), r.cfg.outputChannels(), r.cfg.BitsPerSample, mask)
+		}
+		write := writeWavHeaderFormat
+		if r.cfg.Format == FormatWAV64 {
+			write = writeRF64Header
+		}
+		layout, err := write(r.out, format, ext, 1, dataSize, r.wavChunks())
+		r.wavLayout = layout
+		return err
+	default:
+		layout, err := writeWavHeader(r.out, r.cfg.wavFormatTag(), int(r.outputRate), r.cfg.outputChannels(), r.cfg.outputBits(), dataSize, r.wavChunks())
+		r.wavLayout = layout
+		return err
+	}
+}
+
+// wavChunks returns the metadata chunks placed before the data chunk of a WAV
+// file.
+func (r *Recorder) wavChunks() []byte {
+	now := time.Now()
+	if r.countdownLeft > 0 {
+		// The audio only starts once the countdown is over.
+		now = now.Add(r.cfg.Countdown)
+	}
+	if !r.started {
+		// Nor before the prebuffer is discarded.
+		now = now.Add(r.cfg.Prebuffer)
+	}
+	return append(r.cfg.bextChunk(now, r.outputRate), r.cfg.infoChunk(now)...)
+}
+
+// finalizeHeader patches the sizes in the header once recording has ended.
+// Nothing is patched for formats without a header or for unseekable outputs.
+// Encoded formats instead wait for the encoder to flush.
+func (r *Recorder) finalizeHeader() error {
+	if r.cfg.Trim && r.encoder == nil {
+		if err := r.trim(); err != nil {
+			return fmt.Errorf("trimming: %w", err)
+		}
+	}
+	trailer := r.finalizeMarkers()
+	if r.encoder != nil {
+		return r.encoder.Close()
+	}
+	if r.planar != nil {
+		return r.planar.finalize()
+	}
+	if r.cfg.Normalize {
+		if err := r.normalize(); err != nil {
+			return fmt.Errorf("normalizing: %w", err)
+		}
+	}
+	if r.seeker == nil {
+		return nil
+	}
+	switch r.cfg.Format {
+	case FormatRaw:
+		return nil
+	case FormatAIFF:
+		return updateAiffHeader(r.seeker, r.cfg.outputChannels(), r.cfg.BitsPerSample, uint32(min(r.totalBytesWritten, unknownDataSize)))
+	default:
+		return updateWavHeader(r.seeker, r.wavLayout, r.totalBytesWritten, trailer)
+	}
+}
+
+// startEncoder starts an external encoder and redirects the sample data into
+// it. The encoder owns the output from then on, so no header is patched.
+func (r *Recorder) startEncoder(start func() (*externalEncoder, error)) error {
+	enc, err := start()
+	if err != nil {
+		return err
+	}
+	r.encoder = enc
+	r.out = enc
+	r.seeker = nil
+	return nil
+}
+
+// byteOrder returns the sample byte order of the output format.
+func (cfg Config) byteOrder() binary.AppendByteOrder {
+	if cfg.Format == FormatAIFF || cfg.Format == FormatRaw && cfg.BigEndian {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
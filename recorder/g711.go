@@ -0,0 +1,96 @@
+package recorder
+
+// G.711 companding, after the reference implementation by Sun Microsystems.
+// Encoders take 16-bit linear samples; A-law keeps their top 13 bits and
+// μ-law their top 14.
+
+const (
+	wavFormatALaw = 6
+	wavFormatULaw = 7
+
+	g711SegShift  = 4
+	g711SegMask   = 0x70
+	g711QuantMask = 0x0F
+	g711SignBit   = 0x80
+	ulawBias      = 0x84
+	ulawClip      = 8159
+)
+
+var (
+	alawSegEnd = [8]int{0x1F, 0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF}
+	ulawSegEnd = [8]int{0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF, 0x1FFF}
+)
+
+// g711Segment returns the index of the first segment whose end is at least
+// v, or len(ends) if v is beyond them all.
+func g711Segment(v int, ends *[8]int) int {
+	for i, end := range ends {
+		if v <= end {
+			return i
+		}
+	}
+	return len(ends)
+}
+
+func linearToALaw(pcm int16) byte {
+	v := int(pcm) >> 3
+	mask := byte(0xD5)
+	if v < 0 {
+		mask = 0x55
+		v = -v - 1
+	}
+	seg := g711Segment(v, &alawSegEnd)
+	if seg >= 8 {
+		return 0x7F ^ mask
+	}
+	a := byte(seg << g711SegShift)
+	if seg < 2 {
+		a |= byte(v>>1) & g711QuantMask
+	} else {
+		a |= byte(v>>seg) & g711QuantMask
+	}
+	return a ^ mask
+}
+
+func alawDecode(a byte) int16 {
+	a ^= 0x55
+	t := int(a&g711QuantMask) << 4
+	switch seg := int(a&g711SegMask) >> g711SegShift; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t = (t + 0x108) << (seg - 1)
+	}
+	if a&g711SignBit == 0 {
+		t = -t
+	}
+	return int16(t)
+}
+
+func linearToULaw(pcm int16) byte {
+	v := int(pcm) >> 2
+	mask := byte(0xFF)
+	if v < 0 {
+		mask = 0x7F
+		v = -v
+	}
+	v = min(v, ulawClip) + ulawBias>>2
+	seg := g711Segment(v, &ulawSegEnd)
+	if seg >= 8 {
+		return 0x7F ^ mask
+	}
+	u := byte(seg<<g711SegShift) | byte(v>>(seg+1))&g711QuantMask
+	return u ^ mask
+}
+
+func ulawDecode(u byte) int16 {
+	u = ^u
+	t := int(u&g711QuantMask)<<3 + ulawBias
+	t <<= int(u&g711SegMask) >> g711SegShift
+	if u&g711SignBit != 0 {
+		return int16(ulawBias - t)
+	}
+	return int16(t - ulawBias)
+}
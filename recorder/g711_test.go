@@ -0,0 +1,54 @@
+package recorder
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestG711(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		encode func(int16) byte
+		decode func(byte) int16
+	}{
+		{"A-law", linearToALaw, alawDecode},
+		{"μ-law", linearToULaw, ulawDecode},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			levels := make([]int, 0, 256)
+			for c := range 256 {
+				v := tt.decode(byte(c))
+				levels = append(levels, int(v))
+				// μ-law codes zero twice, and 0x7F, negative zero, comes back
+				// as 0xFF.
+				if got := tt.encode(v); got != byte(c) && !(tt.name == "μ-law" && c == 0x7F && got == 0xFF) {
+					t.Errorf("code %#02x decodes to %d, which encodes to %#02x", c, v, got)
+				}
+			}
+			slices.Sort(levels)
+			levels = slices.Compact(levels)
+
+			// Every sample decodes to a level no further from it than the
+			// step between the levels around it, or to the outermost one.
+			for x := math.MinInt16; x <= math.MaxInt16; x++ {
+				d := int(tt.decode(tt.encode(int16(x))))
+				i, _ := slices.BinarySearch(levels, x)
+				switch {
+				case i == 0:
+					if d != levels[0] {
+						t.Fatalf("%d decodes to %d, want %d", x, d, levels[0])
+					}
+				case i == len(levels):
+					if d != levels[i-1] {
+						t.Fatalf("%d decodes to %d, want %d", x, d, levels[i-1])
+					}
+				default:
+					if step := levels[i] - levels[i-1]; max(d-x, x-d) > step {
+						t.Fatalf("%d decodes to %d, more than the step of %d off", x, d, step)
+					}
+				}
+			}
+		})
+	}
+}
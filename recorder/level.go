@@ -0,0 +1,133 @@
+package recorder
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// minDBFS is reported for digital silence instead of negative infinity.
+const minDBFS = -120.0
+
+// Level is the input level of the most recently captured buffer.
+type Level struct {
+	Peak float64 // Largest absolute sample, in dBFS.
+	RMS  float64 // Root mean square of all samples, in dBFS.
+}
+
+// Level returns the level of the most recently captured buffer. It is safe to
+// call while recording.
+func (r *Recorder) Level() Level {
+	return Level{
+		Peak: math.Float64frombits(r.peak.Load()),
+		RMS:  math.Float64frombits(r.rms.Load()),
+	}
+}
+
+// measureLevel computes the peak and RMS level of the captured buffer, before
+// any gain is applied.
+func (r *Recorder) measureLevel() Level {
+	n := r.numSamples()
+	if n == 0 {
+		return Level{Peak: minDBFS, RMS: minDBFS}
+	}
+
+	peak, sumSquares := 0.0, 0.0
+	for i := 0; i < n; i++ {
+		s := r.sample(i)
+		peak = math.Max(peak, math.Abs(s))
+		sumSquares += s * s
+	}
+	return Level{
+		Peak: toDBFS(peak),
+		RMS:  toDBFS(math.Sqrt(sumSquares / float64(n))),
+	}
+}
+
+// silenceTimedOut tracks consecutive buffers below Config.SilenceThreshold and
+// reports whether they add up to more than Config.SilenceTimeout. The count
+// only starts once a buffer above the threshold has been seen and resets with
+// every such buffer.
+func (r *Recorder) silenceTimedOut(l Level) bool {
+	if r.cfg.SilenceTimeout <= 0 {
+		return false
+	}
+	if l.RMS >= r.cfg.SilenceThreshold {
+		r.heardSound = true
+		r.silentFrames = 0
+		return false
+	}
+	if !r.heardSound {
+		return false
+	}
+
+	r.silentFrames += int64(r.numSamples() / r.cfg.Channels)
+	silent := time.Duration(float64(r.silentFrames) / r.sampleRate * float64(time.Second))
+	return silent > r.cfg.SilenceTimeout
+}
+
+func (r *Recorder) storeLevel(l Level) {
+	r.peak.Store(math.Float64bits(l.Peak))
+	r.rms.Store(math.Float64bits(l.RMS))
+}
+
+// levelCell holds a Level for readers outside the capture loop.
+type levelCell struct {
+	peak, rms atomic.Uint64 // math.Float64bits of the Level's fields.
+}
+
+func (c *levelCell) store(l Level) {
+	c.peak.Store(math.Float64bits(l.Peak))
+	c.rms.Store(math.Float64bits(l.RMS))
+}
+
+func (c *levelCell) load() Level {
+	return Level{
+		Peak: math.Float64frombits(c.peak.Load()),
+		RMS:  math.Float64frombits(c.rms.Load()),
+	}
+}
+
+// ChannelLevels returns the level of each input channel in the most recently
+// captured buffer, before any mixing or gain. It is safe to call while
+// recording.
+func (r *Recorder) ChannelLevels() []Level {
+	if r.cfg.Channels == 1 {
+		return []Level{r.Level()}
+	}
+	levels := make([]Level, len(r.channelLevels))
+	for c := range levels {
+		levels[c] = r.channelLevels[c].load()
+	}
+	return levels
+}
+
+// storeChannelLevels measures each channel of the captured buffer for
+// ChannelLevels.
+func (r *Recorder) storeChannelLevels() {
+	ch := r.cfg.Channels
+	frames := r.numSamples() / ch
+	if frames == 0 {
+		return
+	}
+	for c := 0; c < ch; c++ {
+		peak, sumSquares := 0.0, 0.0
+		for i := c; i < frames*ch; i += ch {
+			s := r.sample(i)
+			peak = math.Max(peak, math.Abs(s))
+			sumSquares += s * s
+		}
+		r.channelLevels[c].store(Level{
+			Peak: toDBFS(peak),
+			RMS:  toDBFS(math.Sqrt(sumSquares / float64(frames))),
+		})
+	}
+}
+
+// toDBFS converts a normalized amplitude to dBFS, bottoming out at minDBFS.
+func toDBFS(v float64) float64 {
+	if v <= 0 {
+		return minDBFS
+	}
+	return math.Max(minDBFS, 20*math.Log10(v))
+}
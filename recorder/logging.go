@@ -0,0 +1,22 @@
+package recorder
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+var pkgLogger atomic.Pointer[slog.Logger]
+
+// SetLogger directs the package's messages to l. Progress is logged at Info,
+// recoverable problems such as input overflows at Warn. A nil l restores the
+// default, slog.Default.
+func SetLogger(l *slog.Logger) {
+	pkgLogger.Store(l)
+}
+
+func logger() *slog.Logger {
+	if l := pkgLogger.Load(); l != nil {
+		return l
+	}
+	return slog.Default()
+}
@@ -0,0 +1,39 @@
+package recorder
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// loopbackNames returns the names under which host APIs list the capture of
+// what plays on the output device called name. PortAudio has no loopback
+// flag of its own; its WASAPI host API instead adds a "[Loopback]" input for
+// every output, and PulseAudio a "Monitor of" source.
+func loopbackNames(name string) []string {
+	return []string{name + " [Loopback]", "Monitor of " + name}
+}
+
+// findLoopback returns the input device that captures what plays on the
+// output device found for spec as findDevice does. Host APIs without such
+// inputs, e.g. MME, Core Audio or plain ALSA, get an error.
+func findLoopback(devices []*portaudio.DeviceInfo, api, spec string, channels int) (*portaudio.DeviceInfo, error) {
+	out, err := findDevice(devices, api, spec, 1, output)
+	if err != nil {
+		return nil, err
+	}
+	names := loopbackNames(out.Name)
+	i := slices.IndexFunc(devices, func(dev *portaudio.DeviceInfo) bool {
+		return dev.MaxInputChannels > 0 && hostAPIName(dev) == hostAPIName(out) && slices.Contains(names, dev.Name)
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("%s offers no loopback capture of %s; on Windows use the WASAPI host API, on Linux PulseAudio, or route the output through a virtual device and record that", hostAPIName(out), out.Name)
+	}
+	dev := devices[i]
+	if dev.MaxInputChannels < channels {
+		return nil, fmt.Errorf("loopback device #%d (%s) has %d channels, %d requested", dev.Index, dev.Name, dev.MaxInputChannels, channels)
+	}
+	logger().Info("Recording the output", "device", out.Name, "loopback", dev.Name)
+	return dev, nil
+}
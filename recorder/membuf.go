@@ -0,0 +1,56 @@
+package recorder
+
+import (
+	"errors"
+	"io"
+)
+
+// MemBuffer is an in-memory file for NewRecorderTo, for tests and short
+// captures that should not touch the disk. Unlike a bytes.Buffer it can
+// seek, so the header gets its final sizes and normalization works. The zero
+// value is an empty buffer ready to use.
+type MemBuffer struct {
+	buf []byte
+	off int64
+}
+
+// Bytes returns the contents written so far, such as a complete WAV file once
+// the Recorder is stopped. The slice is valid until the next write.
+func (b *MemBuffer) Bytes() []byte {
+	return b.buf
+}
+
+func (b *MemBuffer) Write(p []byte) (int, error) {
+	if end := b.off + int64(len(p)); end > int64(len(b.buf)) {
+		b.buf = append(b.buf, make([]byte, end-int64(len(b.buf)))...)
+	}
+	n := copy(b.buf[b.off:], p)
+	b.off += int64(n)
+	return n, nil
+}
+
+func (b *MemBuffer) Read(p []byte) (int, error) {
+	if b.off >= int64(len(b.buf)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.buf[b.off:])
+	b.off += int64(n)
+	return n, nil
+}
+
+func (b *MemBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += b.off
+	case io.SeekEnd:
+		offset += int64(len(b.buf))
+	default:
+		return 0, errors.New("MemBuffer.Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("MemBuffer.Seek: negative position")
+	}
+	b.off = offset
+	return offset, nil
+}
@@ -0,0 +1,155 @@
+package recorder
+
+// DownmixMode selects how inputs with more than two channels are folded into
+// the output file.
+type DownmixMode int
+
+const (
+	// DownmixStereo averages the even-indexed channels into the left and the
+	// odd-indexed channels into the right output channel.
+	DownmixStereo DownmixMode = iota
+	// DownmixMono averages all channels into a single output channel.
+	DownmixMono
+)
+
+// CombineMode selects how channels folded into one output channel, by
+// Downmix or MixMonoMix, are combined.
+type CombineMode string
+
+const (
+	CombineAverage CombineMode = "average" // The mean, never louder than the loudest input; the default.
+	// CombineSum adds the channels, clamped to full scale.
+	CombineSum CombineMode = "sum"
+	// CombineSum3dB adds the channels and attenuates the sum by 3 dB, which
+	// keeps the loudness of uncorrelated channels, clamped to full scale.
+	CombineSum3dB CombineMode = "sum-3db"
+)
+
+// MixMode selects the output channels explicitly, overriding the default of
+// keeping one or two input channels as they are and folding more per
+// DownmixMode.
+type MixMode string
+
+const (
+	MixDefault   MixMode = ""
+	MixMonoLeft  MixMode = "mono-left"  // The first input channel only.
+	MixMonoRight MixMode = "mono-right" // The second input channel only.
+	MixMonoMix   MixMode = "mono-mix"   // The average of all input channels.
+	// MixStereo passes two channels through, folds more like DownmixStereo
+	// and duplicates a single one.
+	MixStereo MixMode = "stereo"
+)
+
+// outputBits is the sample depth written to the file.
+func (cfg Config) outputBits() int {
+	switch {
+	case cfg.Format == FormatADPCM:
+		return 4
+	case cfg.Format.coded():
+		return 8
+	}
+	return cfg.BitsPerSample
+}
+
+// outputChannels is the channel count written to the file.
+func (cfg Config) outputChannels() int {
+	switch {
+	case len(cfg.ChannelMap) > 0:
+		return len(cfg.ChannelMap)
+	case cfg.Mix == MixMonoLeft, cfg.Mix == MixMonoRight, cfg.Mix == MixMonoMix:
+		return 1
+	case cfg.Mix == MixStereo:
+		return 2
+	case cfg.Channels <= 2, cfg.Planar:
+		return cfg.Channels
+	case cfg.Downmix == DownmixMono:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// mixFrame returns the output samples for the input frame starting at sample
+// index i. The returned slice is reused by the next call.
+func (r *Recorder) mixFrame(i int) []float64 {
+	frame := r.frame[:0]
+	if r.cfg.ChannelMap != nil {
+		for _, ch := range r.cfg.ChannelMap {
+			frame = append(frame, r.sample(i+ch))
+		}
+		r.frame = frame
+		return frame
+	}
+	switch r.cfg.Mix {
+	case MixMonoLeft:
+		frame = append(frame, r.sample(i))
+	case MixMonoRight:
+		frame = append(frame, r.sample(i+1))
+	case MixMonoMix:
+		frame = append(frame, r.average(i, 0, 1))
+	case MixStereo:
+		switch r.cfg.Channels {
+		case 1:
+			frame = append(frame, r.sample(i), r.sample(i))
+		case 2:
+			frame = append(frame, r.sample(i), r.sample(i+1))
+		default:
+			frame = append(frame, r.average(i, 0, 2), r.average(i, 1, 2))
+		}
+	default:
+		frame = r.defaultMix(frame, i)
+	}
+	r.frame = frame
+	return frame
+}
+
+// defaultMix appends the output samples of MixDefault for the input frame
+// starting at sample index i.
+func (r *Recorder) defaultMix(frame []float64, i int) []float64 {
+	if r.cfg.Planar {
+		// Every channel is kept for its own file.
+		for k := range r.cfg.Channels {
+			frame = append(frame, r.sample(i+k))
+		}
+		return frame
+	}
+	switch r.cfg.Channels {
+	case 1:
+		frame = append(frame, r.sample(i))
+	case 2:
+		frame = append(frame, r.sample(i), r.sample(i+1))
+	default:
+		if r.cfg.Downmix == DownmixMono {
+			frame = append(frame, r.average(i, 0, 1))
+		} else {
+			frame = append(frame, r.average(i, 0, 2), r.average(i, 1, 2))
+		}
+	}
+	return frame
+}
+
+// average combines every step-th channel of the frame starting at sample
+// index i, beginning with channel first, per Config.Combine: by default into
+// their mean.
+func (r *Recorder) average(i, first, step int) float64 {
+	sum, n := 0.0, 0
+	for k := first; k < r.cfg.Channels; k += step {
+		sum += r.sample(i + k)
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	switch r.cfg.Combine {
+	case CombineSum:
+	case CombineSum3dB:
+		sum *= fromDBFS(-3)
+	default:
+		return sum / float64(n)
+	}
+	if sum > 1 || sum < -1 {
+		r.clips.clamped++
+		sum = max(-1, min(sum, 1))
+	}
+	return sum
+}
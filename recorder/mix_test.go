@@ -0,0 +1,113 @@
+package recorder
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStereoInterleave(t *testing.T) {
+	const frames = 96
+	var samples []float64
+	for i := range frames {
+		samples = append(samples, pcm16(int16(1000+i)), pcm16(int16(-1000-i)))
+	}
+	w, data := readWav(t, record(t, Config{Channels: 2}, 2, frames, samples))
+	if w.Channels() != 2 {
+		t.Fatalf("%d channels, want 2", w.Channels())
+	}
+	got := int16s(data)
+	if len(got) != 2*frames {
+		t.Fatalf("%d samples, want %d", len(got), 2*frames)
+	}
+	for i := range frames {
+		if l, r := got[2*i], got[2*i+1]; l != int16(1000+i) || r != int16(-1000-i) {
+			t.Fatalf("frame %d is %d, %d, want %d, %d", i, l, r, 1000+i, -1000-i)
+		}
+	}
+}
+
+// recordFrames records the 16-bit input frames with cfg and returns the
+// samples written.
+func recordFrames(t *testing.T, cfg Config, frames [][]int16) []int16 {
+	t.Helper()
+	var samples []float64
+	for _, f := range frames {
+		for _, s := range f {
+			samples = append(samples, pcm16(s))
+		}
+	}
+	cfg.Channels = len(frames[0])
+	_, data := readWav(t, record(t, cfg, cfg.Channels, len(frames), samples))
+	return int16s(data)
+}
+
+// checkSamples reports samples of got more than one step off want, to allow
+// for the rounding of the float mix.
+func checkSamples(t *testing.T, got, want []int16) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%d samples, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if d := int(got[i]) - int(want[i]); d < -1 || d > 1 {
+			t.Errorf("sample %d is %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDownmix4Channels(t *testing.T) {
+	frames := [][]int16{
+		{1000, 2000, 3000, 4000},
+		{-4000, 8000, 0, -2000},
+		{32767, 32767, 32767, 32767},
+		{-32768, 32767, -32768, 32767},
+	}
+	t.Run("stereo", func(t *testing.T) {
+		// Channels 0 and 2 make the left, 1 and 3 the right.
+		got := recordFrames(t, Config{Downmix: DownmixStereo}, frames)
+		checkSamples(t, got, []int16{2000, 3000, -2000, 3000, 32767, 32767, -32768, 32767})
+	})
+	t.Run("mono", func(t *testing.T) {
+		got := recordFrames(t, Config{Downmix: DownmixMono}, frames)
+		checkSamples(t, got, []int16{2500, 500, 32767, 0})
+	})
+}
+
+func TestInvertChannels(t *testing.T) {
+	frames := [][]int16{
+		{1000, 1000},
+		{-1000, -1000},
+		{32767, 32767},
+		{-32768, -32768},
+		{0, 0},
+	}
+	got := recordFrames(t, Config{InvertChannels: []int{1}}, frames)
+	// The most negative sample has no positive counterpart and saturates.
+	want := []int16{1000, -1000, -1000, 1000, 32767, -32767, -32768, 32767, 0, 0}
+	if !slices.Equal(got, want) {
+		t.Errorf("samples %v, want %v", got, want)
+	}
+}
+
+func TestCombineModes(t *testing.T) {
+	frames := [][]int16{
+		{8000, 4000},
+		{-6000, 2000},
+		{30000, 20000},
+		{-30000, -20000},
+	}
+	for _, tt := range []struct {
+		mode CombineMode
+		want []int16
+	}{
+		{CombineAverage, []int16{6000, -2000, 25000, -25000}},
+		{CombineSum, []int16{12000, -4000, 32767, -32767}},
+		// 3 dB down is a factor of 0.7079.
+		{CombineSum3dB, []int16{8495, -2831, 32767, -32767}},
+	} {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			got := recordFrames(t, Config{Mix: MixMonoMix, Combine: tt.mode}, frames)
+			checkSamples(t, got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package recorder
+
+import (
+	"errors"
+	"math"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// monitorParams selects the output half of the duplex stream used by
+// Config.Monitor.
+//
+// Blocking duplex I/O reads one buffer of Config.FramesPerBuffer frames and
+// then writes it, so what is heard lags the microphone by the input latency,
+// one buffer (about 11 ms for the default 512 frames at 44.1 kHz) and the
+// output latency. The low-latency defaults keep that short enough to judge
+// levels by ear; a busy machine may underrun the output instead, which only
+// causes clicks in the monitor, never gaps in the file.
+func monitorParams(devices []*portaudio.DeviceInfo, cfg Config) (portaudio.StreamDeviceParameters, error) {
+	dev, err := findDevice(devices, cfg.HostAPI, cfg.MonitorDevice, cfg.outputChannels(), output)
+	if err != nil {
+		return portaudio.StreamDeviceParameters{}, err
+	}
+	logger().Info("Monitoring; use headphones to avoid feedback", "device", dev.Name)
+	return portaudio.StreamDeviceParameters{
+		Device:   dev,
+		Channels: cfg.outputChannels(),
+		Latency:  cfg.latency(dev.DefaultLowOutputLatency, dev.DefaultHighOutputLatency),
+	}, nil
+}
+
+// monitorFrame copies the n-th processed frame of the buffer into the
+// monitor buffer, with the current volume applied as in the file.
+func (r *Recorder) monitorFrame(n int, frame []float64) {
+	if r.monitor == nil {
+		return
+	}
+	if n == 0 {
+		clear(r.monitor)
+	}
+	v := r.Volume()
+	for k, s := range frame {
+		r.monitor[n*len(frame)+k] = float32(math.Max(-1, math.Min(1, s*v)))
+	}
+}
+
+// playMonitor writes the monitor buffer to the output side of the duplex
+// stream. Output underflows are expected when the machine is busy and are
+// ignored.
+func (r *Recorder) playMonitor() error {
+	if r.monitor == nil {
+		return nil
+	}
+	if err := r.stream.Write(); err != nil && !errors.Is(err, portaudio.OutputUnderflowed) {
+		return err
+	}
+	return nil
+}
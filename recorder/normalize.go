@@ -0,0 +1,84 @@
+package recorder
+
+import (
+	"io"
+	"math"
+)
+
+// normalizeChunk is the number of bytes read per step of the normalization
+// passes.
+const normalizeChunk = 64 << 10
+
+// normalize scales the sample data of the current file so that its peak
+// sits at Config.NormalizeTarget dBFS. It reads the data back from the file
+// and rewrites it in place, so it needs an output that can read and seek;
+// stdout, pipes and encoded formats are left untouched. The file is left
+// positioned at the end of the data.
+func (r *Recorder) normalize() error {
+	rws, ok := r.out.(io.ReadWriteSeeker)
+	if !ok || r.seeker == nil || r.encoder != nil {
+		logger().Warn("Skipping normalization: the output cannot be rewritten")
+		return nil
+	}
+	end, err := rws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	start := end - r.totalBytesWritten
+	size := r.cfg.BitsPerSample / 8
+	// Chunks hold whole samples.
+	buf := make([]byte, normalizeChunk/size*size)
+
+	peak := 0.0
+	err = r.eachDataChunk(rws, start, end, buf, func(b []byte) bool {
+		for i := 0; i+size <= len(b); i += size {
+			peak = math.Max(peak, math.Abs(r.decodeSample(b[i:])))
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if peak == 0 {
+		return nil
+	}
+	gain := fromDBFS(r.cfg.NormalizeTarget) / peak
+	logger().Info("Normalizing", "peakDBFS", toDBFS(peak), "targetDBFS", r.cfg.NormalizeTarget)
+
+	err = r.eachDataChunk(rws, start, end, buf, func(b []byte) bool {
+		for i := 0; i+size <= len(b); i += size {
+			// Appending to the empty slice at i overwrites the sample.
+			r.encodeSample(b[i:i], r.decodeSample(b[i:])*gain)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	_, err = rws.Seek(end, io.SeekStart)
+	return err
+}
+
+// eachDataChunk passes the bytes between start and end to fn in pieces of up
+// to len(buf), writing each piece back in place if fn returns true.
+func (r *Recorder) eachDataChunk(rws io.ReadWriteSeeker, start, end int64, buf []byte, fn func([]byte) bool) error {
+	for pos := start; pos < end; {
+		b := buf[:min(int64(len(buf)), end-pos)]
+		if _, err := rws.Seek(pos, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(rws, b); err != nil {
+			return err
+		}
+		if fn(b) {
+			if _, err := rws.Seek(pos, io.SeekStart); err != nil {
+				return err
+			}
+			if _, err := rws.Write(b); err != nil {
+				return err
+			}
+		}
+		pos += int64(len(b))
+	}
+	return nil
+}
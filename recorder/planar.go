@@ -0,0 +1,116 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// planarPath returns the path of the file holding channel ch of a planar
+// recording, e.g. out.ch0.wav for out.wav.
+func planarPath(path string, ch int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.ch%d%s", strings.TrimSuffix(path, ext), ch, ext)
+}
+
+// planarWriter de-interleaves the sample data written to it into one mono
+// WAV file per channel. Writes must hold whole frames.
+type planarWriter struct {
+	files      []*os.File
+	sampleSize int
+	layout     wavLayout
+	dataSize   int64 // Of each file.
+	bufs       [][]byte
+}
+
+func (p *planarWriter) Write(b []byte) (int, error) {
+	for ch := range p.bufs {
+		p.bufs[ch] = p.bufs[ch][:0]
+	}
+	frameSize := p.sampleSize * len(p.files)
+	for i := 0; i+frameSize <= len(b); i += frameSize {
+		for ch := range p.bufs {
+			s := b[i+ch*p.sampleSize:][:p.sampleSize]
+			p.bufs[ch] = append(p.bufs[ch], s...)
+		}
+	}
+	for ch, f := range p.files {
+		if _, err := f.Write(p.bufs[ch]); err != nil {
+			return 0, err
+		}
+	}
+	p.dataSize += int64(len(p.bufs[0]))
+	return len(b), nil
+}
+
+// writeHeaders writes the mono WAV header of every file, with the sizes
+// left to finalize.
+func (p *planarWriter) writeHeaders(r *Recorder) error {
+	for _, f := range p.files {
+		layout, err := writeWavHeader(f, r.cfg.wavFormatTag(), int(r.outputRate), 1, r.cfg.BitsPerSample, 0, r.wavChunks())
+		if err != nil {
+			return err
+		}
+		p.layout = layout
+	}
+	return nil
+}
+
+// finalize patches the sizes in the header of every file.
+func (p *planarWriter) finalize() error {
+	var errs []error
+	for _, f := range p.files {
+		errs = append(errs, updateWavHeader(f, p.layout, p.dataSize, nil))
+	}
+	return errors.Join(errs...)
+}
+
+func (p *planarWriter) Close() error {
+	var errs []error
+	for _, f := range p.files {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// remove closes and deletes the files created so far.
+func (p *planarWriter) remove() {
+	for _, f := range p.files {
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+// newPlanarRecorder is NewRecorder for Config.Planar: it creates one file
+// per output channel once the channel count is known.
+func newPlanarRecorder(cfg Config) (*Recorder, error) {
+	r, err := openRecorder(cfg, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	channels := r.cfg.outputChannels()
+	p := &planarWriter{sampleSize: r.cfg.BitsPerSample / 8, bufs: make([][]byte, channels)}
+	for ch := range channels {
+		path := planarPath(cfg.OutputPath, ch)
+		f, err := CreateOutput(path, cfg.Overwrite)
+		if err != nil {
+			p.remove()
+			r.Stop()
+			return nil, err
+		}
+		p.files = append(p.files, f)
+		r.files = append(r.files, path)
+	}
+	r.diskPath = r.files[0]
+	if err := r.checkDiskSpace(r.diskPath); err != nil {
+		p.remove()
+		r.Stop()
+		return nil, err
+	}
+	r.planar = p
+	r.out, r.outCloser = p, p
+	return r, nil
+}
@@ -0,0 +1,108 @@
+package recorder
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// Play plays the WAV file at path on the output device selected by device,
+// which takes the same form as Config.Device with an empty spec selecting the
+// default output. It returns once the file has been played or ctx is done.
+// Integer PCM of 16, 24 and 32 bits and 32-bit float samples are supported.
+func Play(ctx context.Context, path, device string) error {
+	wav, err := OpenWav(path)
+	if err != nil {
+		return err
+	}
+	defer wav.Close()
+
+	channels := wav.Channels()
+	bits := wav.BitsPerSample()
+	sampleFormat := wav.Format()
+	if bits != 16 && bits != 24 && bits != 32 {
+		return fmt.Errorf("%s: playback of %d-bit samples is not supported", path, bits)
+	}
+
+	if err := ensurePortAudio(); err != nil {
+		return err
+	}
+	defer releasePortAudio()
+
+	devices, err := backend().Devices()
+	if err != nil {
+		return err
+	}
+	dev, err := findDevice(devices, "", device, channels, output)
+	if err != nil {
+		return err
+	}
+
+	n := framesPerBuf * channels
+	streamBuf := newStreamBuffer(sampleFormat, bits, n)
+	params := portaudio.StreamParameters{
+		Output: portaudio.StreamDeviceParameters{
+			Device:   dev,
+			Channels: channels,
+			Latency:  dev.DefaultHighOutputLatency,
+		},
+		SampleRate:      float64(wav.SampleRate()),
+		FramesPerBuffer: framesPerBuf,
+	}
+	stream, err := backend().OpenStream(params, streamBuf)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	if err := stream.Start(); err != nil {
+		return err
+	}
+	defer stream.Stop()
+
+	logger().Info("Playing", "path", path, "device", dev.Name, "sampleRate", wav.SampleRate())
+
+	raw := make([]byte, n*bits/8)
+	for ctx.Err() == nil {
+		got, err := io.ReadFull(wav, raw)
+		if got == 0 {
+			break
+		}
+		clear(raw[got:])
+		decodeSamples(streamBuf, raw, bits)
+		if werr := stream.Write(); werr != nil && !errors.Is(werr, portaudio.OutputUnderflowed) {
+			return werr
+		}
+		if err != nil {
+			break
+		}
+	}
+	return ctx.Err()
+}
+
+// decodeSamples fills the stream buffer buf with the little-endian samples
+// in raw. 24-bit samples are widened to the top of an int32.
+func decodeSamples(buf interface{}, raw []byte, bits int) {
+	switch buf := buf.(type) {
+	case []int16:
+		for i := range buf {
+			buf[i] = int16(binary.LittleEndian.Uint16(raw[2*i:]))
+		}
+	case []int32:
+		for i := range buf {
+			if bits == 24 {
+				buf[i] = int32(uint32(raw[3*i])<<8 | uint32(raw[3*i+1])<<16 | uint32(raw[3*i+2])<<24)
+			} else {
+				buf[i] = int32(binary.LittleEndian.Uint32(raw[4*i:]))
+			}
+		}
+	case []float32:
+		for i := range buf {
+			buf[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:]))
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package recorder
+
+import "time"
+
+const (
+	// progressInterval is the audio between calls of Config.OnProgress.
+	progressInterval = 100 * time.Millisecond
+	// progressQueue bounds the updates waiting for a slow OnProgress; newer
+	// ones are dropped while it is full.
+	progressQueue = 8
+)
+
+// progress is an update for Config.OnProgress.
+type progress struct {
+	elapsed  time.Duration
+	bytes    int
+	peakDBFS float64
+}
+
+// startProgress starts the goroutine calling Config.OnProgress, so that a
+// slow callback never holds up the capture loop.
+func (r *Recorder) startProgress() {
+	r.progress = make(chan progress, progressQueue)
+	r.progressDone = make(chan struct{})
+	go func() {
+		defer close(r.progressDone)
+		for p := range r.progress {
+			r.cfg.OnProgress(p.elapsed, p.bytes, p.peakDBFS)
+		}
+	}()
+}
+
+// reportProgress queues an update once progressInterval of audio has been
+// captured since the last one.
+func (r *Recorder) reportProgress(level Level) {
+	if r.framesCaptured < r.nextProgress {
+		return
+	}
+	r.nextProgress = r.framesCaptured + int64(progressInterval.Seconds()*r.sampleRate)
+	select {
+	case r.progress <- progress{r.framesDuration(r.framesCaptured), int(r.dataBytes.Load()), level.Peak}:
+	default:
+	}
+}
+
+// stopProgress waits for the queued updates to be delivered.
+func (r *Recorder) stopProgress() {
+	if r.progress == nil {
+		return
+	}
+	close(r.progress)
+	<-r.progressDone
+}
@@ -0,0 +1,129 @@
+package recorder
+
+import (
+	"math"
+	"os"
+	"slices"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// RatePolicy selects among the sample rates a device supports when
+// Config.SampleRate is zero.
+type RatePolicy string
+
+const (
+	// RateFirst takes the first supported rate in the order of
+	// possibleSampleRates, followed by the device's default rate.
+	RateFirst RatePolicy = "first"
+	// RateHighest and RateLowest take the highest and lowest supported rate.
+	RateHighest RatePolicy = "highest"
+	RateLowest  RatePolicy = "lowest"
+	// RateNearest takes the supported rate closest to the device's default
+	// rate, which is usually the default rate itself.
+	RateNearest RatePolicy = "nearest"
+)
+
+// chooseSampleRate returns the rate to capture from dev at. A requested
+// SampleRate the device does not support falls back to the rate policy, or
+// with resampling to the nearest supported rate.
+func chooseSampleRate(dev *portaudio.DeviceInfo, cfg Config) (float64, error) {
+	candidates := candidateRates(dev)
+	switch {
+	case cfg.ResampleRate > 0 && cfg.SampleRate > 0:
+		return nearestSampleRate(dev, candidates, cfg.Channels, cfg.SampleFormat, cfg.BitsPerSample, cfg.SampleRate)
+	case cfg.ResampleRate > 0:
+		return nearestSampleRate(dev, candidates, cfg.Channels, cfg.SampleFormat, cfg.BitsPerSample, cfg.ResampleRate)
+	case cfg.SampleRate > 0:
+		if isSampleRateSupported(dev, cfg.Channels, cfg.SampleFormat, cfg.BitsPerSample, cfg.SampleRate) {
+			return cfg.SampleRate, nil
+		}
+		rate, err := findWorkingSampleRate(dev, candidates, cfg.Channels, cfg.SampleFormat, cfg.BitsPerSample, cfg.RatePolicy)
+		if err == nil {
+			logger().Warn("Sample rate not supported", "device", dev.Name, "requested", cfg.SampleRate, "using", rate)
+		}
+		return rate, err
+	default:
+		return findWorkingSampleRate(dev, candidates, cfg.Channels, cfg.SampleFormat, cfg.BitsPerSample, cfg.RatePolicy)
+	}
+}
+
+// candidateRates returns possibleSampleRates with the device's default rate
+// appended if it is not among them.
+func candidateRates(dev *portaudio.DeviceInfo) []float64 {
+	rates := slices.Clone(possibleSampleRates)
+	if dev.DefaultSampleRate > 0 && !slices.Contains(rates, dev.DefaultSampleRate) {
+		rates = append(rates, dev.DefaultSampleRate)
+	}
+	return rates
+}
+
+// findWorkingSampleRate picks a rate among the candidates dev supports
+// according to policy.
+func findWorkingSampleRate(dev *portaudio.DeviceInfo, candidates []float64, channels int, format SampleFormat, bitsPerSample int, policy RatePolicy) (float64, error) {
+	rates := supportedSampleRates(dev, candidates, channels, format, bitsPerSample)
+	if len(rates) == 0 {
+		return 0, os.ErrInvalid
+	}
+	switch policy {
+	case RateHighest:
+		return slices.Max(rates), nil
+	case RateLowest:
+		return slices.Min(rates), nil
+	case RateNearest:
+		return nearestOf(rates, dev.DefaultSampleRate), nil
+	default:
+		return rates[0], nil
+	}
+}
+
+// nearestSampleRate returns target if the device supports it, and otherwise
+// the supported candidate rate closest to it.
+func nearestSampleRate(dev *portaudio.DeviceInfo, candidates []float64, channels int, format SampleFormat, bitsPerSample int, target float64) (float64, error) {
+	if isSampleRateSupported(dev, channels, format, bitsPerSample, target) {
+		return target, nil
+	}
+	rates := supportedSampleRates(dev, candidates, channels, format, bitsPerSample)
+	if len(rates) == 0 {
+		return 0, os.ErrInvalid
+	}
+	return nearestOf(rates, target), nil
+}
+
+func nearestOf(rates []float64, target float64) float64 {
+	best := rates[0]
+	for _, rate := range rates[1:] {
+		if math.Abs(rate-target) < math.Abs(best-target) {
+			best = rate
+		}
+	}
+	return best
+}
+
+// supportedSampleRates returns the candidate rates the device accepts for
+// the given channel count and sample format.
+func supportedSampleRates(dev *portaudio.DeviceInfo, candidates []float64, channels int, format SampleFormat, bitsPerSample int) []float64 {
+	var rates []float64
+	for _, rate := range candidates {
+		if isSampleRateSupported(dev, channels, format, bitsPerSample, rate) {
+			rates = append(rates, rate)
+		}
+	}
+	return rates
+}
+
+func isSampleRateSupported(dev *portaudio.DeviceInfo, channels int, format SampleFormat, bitsPerSample int, rate float64) bool {
+	params := portaudio.StreamParameters{
+		Input: portaudio.StreamDeviceParameters{
+			Device:   dev,
+			Channels: channels,
+			Latency:  dev.DefaultLowInputLatency,
+		},
+		Output: portaudio.StreamDeviceParameters{
+			Channels: 0,
+		},
+		SampleRate:      rate,
+		FramesPerBuffer: framesPerBuf,
+	}
+	return backend().IsFormatSupported(params, newStreamBuffer(format, bitsPerSample, 0)) == nil
+}
@@ -0,0 +1,109 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// reconnectDelay is how long to wait between attempts to reopen a lost
+// input device.
+const reconnectDelay = 2 * time.Second
+
+// ErrDeviceLost is wrapped by the error of a recording that ended because
+// its input device went away, e.g. a USB microphone was unplugged. The audio
+// captured until then is kept and the output finalized as usual.
+var ErrDeviceLost = errors.New("input device lost")
+
+// deviceLost reports whether err from reading the stream means the device
+// is gone rather than a transient failure. Host APIs report unplugging
+// differently: ALSA mostly as an unanticipated host or internal error, others
+// as an unavailable device or a timeout.
+func deviceLost(err error) bool {
+	var hostErr portaudio.UnanticipatedHostError
+	var hostErrPtr *portaudio.UnanticipatedHostError
+	return errors.Is(err, portaudio.DeviceUnavailable) ||
+		errors.Is(err, portaudio.InternalError) ||
+		errors.Is(err, portaudio.TimedOut) ||
+		errors.As(err, &hostErr) || errors.As(err, &hostErrPtr)
+}
+
+// reconnect closes the lost stream and reopens one with the same parameters
+// on the device with the same name, retrying every reconnectDelay until it
+// succeeds, Config.ReconnectTimeout has passed or the Recorder is stopped.
+// PortAudio only notices devices that come back after being reinitialized,
+// so every attempt starts with that. It reports whether capture can
+// continue.
+func (r *Recorder) reconnect() bool {
+	r.stream.Close()
+	r.stream = nil
+	lost := time.Now()
+	name := r.device.Name
+	logger().Warn("Input device lost; trying to reconnect", "device", name)
+	var timeout <-chan time.Time
+	if r.cfg.ReconnectTimeout > 0 {
+		timeout = time.After(r.cfg.ReconnectTimeout)
+	}
+	for {
+		select {
+		case <-r.stop:
+			return false
+		case <-timeout:
+			logger().Warn("Giving up on the input device", "device", name, "after", r.cfg.ReconnectTimeout)
+			return false
+		case <-time.After(reconnectDelay):
+		}
+		if err := r.reopen(name); err != nil {
+			logger().Warn("Reconnecting failed", "err", err)
+			continue
+		}
+		logger().Warn("Reconnected; the recording has a gap", "device", r.device.Name, "gap", time.Since(lost).Round(time.Second))
+		return true
+	}
+}
+
+func (r *Recorder) reopen(name string) error {
+	if err := rescanPortAudio(); err != nil {
+		return err
+	}
+	devices, err := backend().Devices()
+	if err != nil {
+		return err
+	}
+	// The same device is listed once per host API, so the one it was
+	// opened through must match as well.
+	i := slices.IndexFunc(devices, func(d *portaudio.DeviceInfo) bool {
+		return d.Name == name && hostAPIName(d) == hostAPIName(r.device) && d.MaxInputChannels >= r.cfg.Channels
+	})
+	if i < 0 {
+		return fmt.Errorf("'%s' is not available", name)
+	}
+	params := r.params
+	params.Input.Device = devices[i]
+	if r.monitor != nil {
+		if params.Output, err = monitorParams(devices, r.cfg); err != nil {
+			return err
+		}
+	}
+	stream, err := backend().OpenStream(params, r.buffers...)
+	if err != nil {
+		return err
+	}
+	if err := stream.Start(); err != nil {
+		stream.Close()
+		return err
+	}
+	if devices[i].Index != r.device.Index {
+		logger().Info("Input device moved", "device", name, "from", r.device.Index, "to", devices[i].Index)
+	}
+	r.stream, r.device = stream, devices[i]
+	r.prebufferLeft = int64(r.cfg.Prebuffer.Seconds() * r.sampleRate)
+	if r.cfg.Verbose {
+		r.readTimer = readTimer{}
+		r.logStreamInfo()
+	}
+	return nil
+}
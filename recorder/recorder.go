@@ -0,0 +1,1067 @@
+package recorder
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// framesPerBuf is the default of Config.FramesPerBuffer.
+const framesPerBuf = 512
+
+// largeFramesPerBuffer is the buffer size above which a warning about the
+// added latency is logged.
+const largeFramesPerBuffer = 8192
+
+var possibleSampleRates = []float64{44100, 48000, 96000, 16000, 32000, 22050}
+
+// SampleFormat selects how samples are captured and encoded.
+type SampleFormat int
+
+const (
+	// PCMInt16 writes integer PCM; the depth is taken from
+	// Config.BitsPerSample.
+	PCMInt16 SampleFormat = iota
+	// Float32 captures and writes 32-bit IEEE float samples.
+	Float32
+)
+
+// AllChannels as Config.Channels captures every input channel of the device.
+const AllChannels = -1
+
+// Config holds the capture and output settings of a Recorder.
+type Config struct {
+	Device        string  // Index or name substring; empty selects the default input.
+	HostAPI       string  // Name substring of the host API, e.g. "WASAPI", to find Device and MonitorDevice in; empty means the default host API.
+	Loopback      bool    // Capture what plays on Device, then an output device, where the host API offers that.
+	Channels      int     // Zero means one; see also AllChannels.
+	SampleRate    float64 // Requested capture rate; zero, or a rate the device lacks, lets RatePolicy choose.
+	BitsPerSample int
+	SampleFormat  SampleFormat
+	Volume        float64
+	GainDB        float64    // Gain in dB multiplied into Volume, within ±maxGainDB.
+	OutputPath    string     // May hold time tokens such as %Y; see NewRecorder.
+	Format        FileFormat // Container of the output; empty means FormatWAV.
+	Bitrate       int        // Target bitrate of lossy formats in kbps; zero picks a default.
+	BigEndian     bool       // Write FormatRaw samples big-endian; other formats fix their byte order.
+	ChannelMask   uint32     // Speaker positions of WAV output; non-zero forces WAVE_FORMAT_EXTENSIBLE.
+
+	OpusApplication string        // OpusVoIP (default) or OpusAudio.
+	Overwrite       bool          // Replace an existing OutputPath instead of failing.
+	Append          bool          // Continue an existing WAV OutputPath of the same format; see NewRecorder.
+	Duration        time.Duration // Zero records until stopped.
+	MaxDuration     time.Duration // Safety cap on the length, logged when it ends a recording; the smaller of it and Duration applies.
+	MinFree         int64         // Bytes to keep free on the output's file system; see NewRecorder.
+	Countdown       time.Duration // Meter but discard this much input before recording; see Recorder.Countdown.
+	Prebuffer       time.Duration // Discard this much input, unmetered, each time the stream starts, trading latency for a clean start.
+	Split           time.Duration // Non-zero starts a new, timestamped file after each such span; see NewRecorder.
+	MaxSize         int64         // Non-zero starts a new, numbered file before one would exceed this many bytes.
+	Downmix         DownmixMode   // Applies to inputs with more than two channels.
+	Mix             MixMode       // Overrides Downmix and the channel count of the output.
+	Combine         CombineMode   // How channels folded together are combined; empty means CombineAverage.
+	Dither          DitherMode    // Noise added when the output is shallower than the capture, or 16-bit output is scaled or processed; empty means DitherNone.
+	RatePolicy      RatePolicy    // Empty means RateFirst.
+
+	// ChannelMap lists the input channels, counted from 0, written as the
+	// output channels in that order, in place of Mix and Downmix. With
+	// Channels zero, as many channels are captured as the highest mapped
+	// one needs.
+	ChannelMap []int
+
+	// FramesPerBuffer is the number of frames read from the device at once,
+	// 512 if zero. Latency is the suggested device latency; zero selects the
+	// device's default low latency, or its default high latency with
+	// HighLatency set.
+	FramesPerBuffer int
+	Latency         time.Duration
+	HighLatency     bool
+
+	// Reconnect keeps a recording going when its input device is lost,
+	// looking the device up again by name, as it may come back under another
+	// index, and continuing into the same file. Without it, or once the
+	// device has been gone for ReconnectTimeout if that is non-zero, the
+	// recording ends with an error wrapping ErrDeviceLost.
+	Reconnect        bool
+	ReconnectTimeout time.Duration
+
+	// Verbose logs the latency and rate the stream runs with, reads that
+	// stall for longer than two buffers, and every ten seconds the stream
+	// clock next to the audio captured and the gaps between reads.
+	Verbose bool
+
+	// Timestamps, if set, receives a line mapping a captured frame, counted
+	// from the start of the recording, to the wall-clock time it reached the
+	// device, net of the input latency, and to the stream clock: for the
+	// first buffer and then every second. Lines are CSV with a header, or
+	// JSON objects if TimestampJSON is set. It is not closed.
+	Timestamps    io.Writer
+	TimestampJSON bool
+
+	// OnBuffer, if set, is called from the capture goroutine with every
+	// buffer read from the device, before it is processed or written. The
+	// samples are the interleaved input channels; they are not a copy and
+	// are overwritten by the next read, so OnBuffer must not keep the slice
+	// after returning, and should return quickly to avoid overflows. It
+	// needs 16-bit integer samples.
+	OnBuffer func(samples []int16, frames int)
+
+	// OnProgress, if set, is called about every 100ms of audio with the
+	// audio captured so far, the sample data written and the peak level of
+	// the last buffer in dBFS. It runs on a goroutine of its own so that it
+	// may block without stalling the capture; updates arriving while a few
+	// are still queued are dropped. Stop waits for the queued ones.
+	OnProgress func(elapsed time.Duration, bytes int, peakDBFS float64)
+
+	// OnTone, if set, is called from the capture goroutine when a buffer
+	// holds a tone of ToneFrequency Hz at ToneThreshold dBFS or louder, -30
+	// if zero, with the frequency and the tone's level in dBFS. A tone that
+	// lasts is reported again at most every half second.
+	OnTone        func(freq, magnitude float64)
+	ToneFrequency float64
+	ToneThreshold float64
+
+	// StreamBuffers is the number of captured buffers queued for each reader
+	// returned by Recorder.Stream, 16 if zero. StreamDropPolicy decides what
+	// happens when that queue is full.
+	StreamBuffers    int
+	StreamDropPolicy DropPolicy
+
+	// Normalize rescales each finished file so that its peak reaches
+	// NormalizeTarget dBFS. The data is read back and rewritten in place, so
+	// this is skipped for outputs that cannot seek, such as stdout and pipes,
+	// and for encoded formats.
+	Normalize       bool
+	NormalizeTarget float64
+
+	// Trim removes leading and trailing audio below SilenceThreshold from each
+	// finished file, keeping TrimMargin (100ms if zero) around the rest. Like
+	// Normalize it rewrites the file in place and is skipped for outputs that
+	// cannot seek.
+	Trim       bool
+	TrimMargin time.Duration
+
+	// Planar writes every captured channel to a mono WAV file of its own,
+	// named after OutputPath with .chN inserted before the extension, e.g.
+	// out.ch0.wav and out.ch1.wav for out.wav, instead of folding them into
+	// one. It takes the place of Mix and Downmix.
+	Planar bool
+
+	// Title, Artist and Comment are stored in a LIST/INFO chunk of WAV
+	// output, along with the creation date, if any of them is set.
+	Title   string
+	Artist  string
+	Comment string
+
+	// BWF adds a Broadcast Wave bext chunk to WAV output, with Comment as its
+	// description, Artist as its originator and the start of the recording as
+	// its origination time.
+	BWF bool
+
+	// ResampleRate, when non-zero, is the sample rate of the output file. The
+	// device captures at SampleRate, or without one at ResampleRate itself,
+	// if it can, otherwise at the nearest rate it supports, and the audio is
+	// resampled.
+	ResampleRate float64
+
+	// SilenceTimeout, when non-zero, stops the recording once the RMS level
+	// has stayed below SilenceThreshold (dBFS) for that long. Silence before
+	// the first louder buffer does not count.
+	SilenceTimeout   time.Duration
+	SilenceThreshold float64
+
+	// Invert flips the polarity of every input channel, InvertChannels that
+	// of the listed ones, counted from 0. Samples are negated as they are
+	// read, ahead of mixing, volume and filters; the most negative integer
+	// sample becomes full scale.
+	Invert         bool
+	InvertChannels []int
+
+	// DCBlock removes a constant offset with a high-pass filter at
+	// DCBlockCutoff Hz, 20 Hz if zero.
+	DCBlock       bool
+	DCBlockCutoff float64
+
+	// EQ is a chain of biquad filters applied to every output channel in
+	// order, after DCBlock.
+	EQ []Filter
+
+	// GateOpen, when non-zero, enables a noise gate that opens once the level
+	// reaches GateOpen (dBFS) and closes again only below GateClose. Gain
+	// changes are smoothed over GateAttack and GateRelease.
+	GateOpen    float64
+	GateClose   float64
+	GateAttack  time.Duration
+	GateRelease time.Duration
+
+	// LimitThreshold, when non-zero, enables a lookahead limiter that keeps
+	// peaks, after the volume is applied, below LimitThreshold dBFS instead of
+	// clipping them. The gain recovers over LimitRelease. The limiter delays
+	// the output by about 5 ms.
+	LimitThreshold float64
+	LimitRelease   time.Duration
+
+	// VAD writes only buffers whose RMS level reaches SilenceThreshold, plus
+	// VADPreRoll of audio before and VADPostRoll after them.
+	VAD         bool
+	VADPreRoll  time.Duration
+	VADPostRoll time.Duration
+
+	// Monitor plays the processed input on MonitorDevice, the default output
+	// if empty, while recording. Both devices share one duplex stream, so
+	// they must belong to the same host API.
+	Monitor       bool
+	MonitorDevice string
+}
+
+// Recorder captures audio from a PortAudio input device into a WAV stream.
+type Recorder struct {
+	cfg        Config
+	device     *portaudio.DeviceInfo
+	stream     Stream // Nil once the device is lost, until reconnected.
+	params     portaudio.StreamParameters
+	buffers    []interface{}
+	buffer     []int16   // Capture buffer for 16-bit output.
+	buffer32   []int32   // Capture buffer for 24- and 32-bit output.
+	bufferF32  []float32 // Capture buffer for float output.
+	monitor    []float32 // Playback buffer of the duplex stream; nil unless monitoring.
+	sampleRate float64   // Capture rate.
+	outputRate float64   // Rate written to the file; differs when resampling.
+	resampler  *linearResampler
+
+	out               io.Writer
+	seeker            io.WriteSeeker // Nil when out cannot seek.
+	outCloser         io.Closer      // Non-nil when the Recorder owns out.
+	encoder           *externalEncoder
+	planar            *planarWriter // Non-nil when out is split into a file per channel.
+	wavLayout         wavLayout
+	adpcm             *adpcmEncoder // Carries partial blocks over to the next file.
+	scratch           []byte        // Encoded samples of the current buffer.
+	byteOrder         binary.AppendByteOrder
+	totalBytesWritten int64        // Sample data in the current file.
+	dataBytes         atomic.Int64 // Sample data in all files.
+	files             []string     // Paths of the files written, oldest first.
+	framesCaptured    int64
+	frames            atomic.Int64 // framesCaptured, for readers outside the capture loop.
+	fileFrames        atomic.Int64 // Frames in the current file, for AddMarker.
+	overflows         atomic.Int64
+	maxFrames         int64         // Derived from Config.Duration and MaxDuration; zero means unlimited.
+	capped            bool          // maxFrames comes from Config.MaxDuration.
+	diskPath          string        // Current output file, for Config.MinFree; empty if not a file.
+	nextDiskCheck     int64         // framesCaptured at which to check the free space again.
+	countdownLeft     int64         // Frames of Config.Countdown still to discard.
+	prebufferLeft     int64         // Frames of Config.Prebuffer still to discard.
+	countdown         atomic.Int64  // countdownLeft, for readers outside the capture loop.
+	lastHotPeak       int64         // countdownLeft at the last clipping warning; zero if none.
+	splitFrames       int64         // Derived from Config.Split; zero means a single file.
+	segmentStart      int64         // framesCaptured when the current file was started.
+	segment           int           // Number of the current file, from 1.
+	volume            atomic.Uint64 // math.Float64bits of the current gain.
+	peak, rms         atomic.Uint64 // math.Float64bits of the last buffer's Level.
+	channelLevels     []levelCell   // Per input channel, if there are several.
+	clips             clipCounts
+	heardSound        bool
+	silentFrames      int64
+	preRoll           byteRing  // Recent gated-out buffers kept for VADPreRoll.
+	postRollFrames    int64     // Frames still to write after the last voiced buffer.
+	frame             []float64 // Output samples of the frame being encoded.
+	gate              *noiseGate
+	limiter           *limiter
+	tone              *toneDetector
+	invert            []bool // Per input channel; nil if none is inverted.
+	dither            *ditherer
+	dcBlock           *dcBlocker
+	eq                []*biquad
+	readTimer         readTimer
+	readTime          time.Time // Of the last read, for Config.Timestamps.
+	nextStamp         int64     // Frame due for the next timestamp.
+
+	progress     chan progress // Nil unless Config.OnProgress is set.
+	progressDone chan struct{}
+	nextProgress int64
+
+	streamsMu     sync.Mutex
+	streams       []*pcmStream
+	streamsClosed bool
+	streamDrops   atomic.Int64
+
+	markersMu sync.Mutex
+	markers   []marker // Of the current file, for its cue chunk.
+
+	appending bool // Continuing an existing file; see Config.Append.
+	started   bool
+	startTime time.Time // Of the audio, after any countdown.
+	stop      chan struct{}
+	finished  chan struct{} // Closed when loop returns.
+	loopErr   error
+
+	stopOnce sync.Once
+	stopErr  error // Returned by every call of Stop.
+}
+
+// NewRecorder initializes PortAudio, opens an input stream on the configured
+// device and creates the output file. The caller must call Stop to release
+// them, even if Start is never called. The tokens %Y, %m, %d, %H, %M and %S
+// in OutputPath are replaced by the local time, as in strftime, and %% by a
+// percent sign; missing directories are created. NewRecorder fails if the
+// file system lacks room for Config.Duration of audio plus Config.MinFree,
+// and with MinFree set the recording stops once less than that is left. With Config.Split set, every file,
+// starting with the first, is named after OutputPath with its start time
+// appended, e.g. rec-20240101-120500.wav for rec.wav; see segmentPath for
+// Config.MaxSize. With Config.Append set, an existing OutputPath is
+// continued instead, capturing at its sample rate; NewRecorder fails if the
+// file's format differs from cfg or the device cannot capture at that rate.
+func NewRecorder(cfg Config) (*Recorder, error) {
+	cfg, err := validateConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.OutputPath, err = expandPath(cfg.OutputPath, time.Now()); err != nil {
+		return nil, err
+	}
+
+	path := cfg.OutputPath
+	if cfg.segmented() {
+		path = segmentPath(cfg, time.Now(), 1)
+	}
+	var target *appendTarget
+	if cfg.Append {
+		if target, err = openAppend(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Planar {
+		return newPlanarRecorder(cfg)
+	}
+	var outFile *os.File
+	if target != nil {
+		outFile = target.f
+		if cfg.ResampleRate == 0 {
+			cfg.SampleRate = target.sampleRate
+		}
+	} else if outFile, err = CreateOutput(path, cfg.Overwrite); err != nil {
+		return nil, err
+	}
+
+	r, err := openRecorder(cfg, outFile)
+	if err != nil {
+		outFile.Close()
+		return nil, err
+	}
+	r.outCloser = outFile
+	r.files = []string{path}
+	r.diskPath = path
+	if target != nil {
+		r.appending = true
+		r.wavLayout = target.layout
+		r.totalBytesWritten = int64(target.dataSize)
+		r.fileFrames.Store(r.dataFrames(int64(target.dataSize)))
+		if got := r.cfg.outputChannels(); got != target.channels {
+			r.abandon()
+			return nil, fmt.Errorf("cannot append to %s: it has %d channels, but %d would be recorded", path, target.channels, got)
+		}
+		if r.outputRate != target.sampleRate {
+			r.abandon()
+			return nil, fmt.Errorf("cannot append to %s: it is sampled at %.0f Hz, but '%s' records at %.0f Hz", path, target.sampleRate, r.device.Name, r.outputRate)
+		}
+		logger().Info("Appending", "path", path, "existingBytes", target.dataSize)
+	}
+	if err := r.checkDiskSpace(path); err != nil {
+		r.abandon()
+		if target == nil {
+			os.Remove(path)
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// abandon releases a Recorder that was never started like Stop does, but
+// leaves the output as it is: a file NewRecorder refused to append to must
+// not be normalized, given markers or have its header rewritten.
+func (r *Recorder) abandon() {
+	r.stopOnce.Do(func() {
+		defer releasePortAudio()
+		if r.stream != nil {
+			r.stream.Close()
+		}
+		if r.outCloser != nil {
+			r.outCloser.Close()
+		}
+	})
+}
+
+// NewRecorderTo is like NewRecorder but writes the WAV stream to w instead of
+// creating Config.OutputPath. w is not closed. If w cannot seek, such as a
+// pipe, the header is written once with unknown sizes and never patched; see
+// writeWavHeader. A MemBuffer records into memory.
+func NewRecorderTo(cfg Config, w io.Writer) (*Recorder, error) {
+	cfg, err := validateConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.segmented() {
+		return nil, &ConfigError{Field: "Split", Err: errors.New("split recordings need an output file created by NewRecorder")}
+	}
+	if cfg.Append {
+		return nil, &ConfigError{Field: "Append", Err: errors.New("appending needs an output file opened by NewRecorder")}
+	}
+	if cfg.Planar {
+		return nil, &ConfigError{Field: "Planar", Err: errors.New("planar recordings need output files created by NewRecorder")}
+	}
+	return openRecorder(cfg, w)
+}
+
+// Record captures audio into w until ctx is cancelled or its deadline
+// elapses, then finalizes the WAV stream. See NewRecorderTo and Run.
+func Record(ctx context.Context, cfg Config, w io.Writer) error {
+	r, err := NewRecorderTo(cfg, w)
+	if err != nil {
+		return err
+	}
+	return r.Run(ctx)
+}
+
+// Run starts the Recorder and stops it once ctx is done or the capture ends
+// on its own. It returns ctx.Err() after a cancellation-triggered stop, or the
+// error that ended the capture early.
+func (r *Recorder) Run(ctx context.Context) error {
+	if err := r.Start(); err != nil {
+		r.Stop()
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-r.finished:
+	}
+	if err := r.Stop(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// CreateOutput creates the file at path along with any missing parent
+// directories. Unless overwrite is set, it fails if the file already exists.
+func CreateOutput(path string, overwrite bool) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating output directory: %w", err)
+	}
+
+	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("%s already exists: %w", path, fs.ErrExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating output: %w", err)
+	}
+	return f, nil
+}
+
+// openRecorder initializes PortAudio and opens the input stream for a
+// Recorder writing to out. PortAudio is released again on failure.
+func openRecorder(cfg Config, out io.Writer) (*Recorder, error) {
+	if err := ensurePortAudio(); err != nil {
+		return nil, fmt.Errorf("initializing PortAudio: %w", err)
+	}
+
+	r, err := newRecorder(cfg, out)
+	if err != nil {
+		releasePortAudio()
+		return nil, err
+	}
+	return r, nil
+}
+
+func newRecorder(cfg Config, out io.Writer) (*Recorder, error) {
+	p, err := planStream(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg = p.cfg
+	device, sampleRate := p.device, p.params.SampleRate
+	if n := bits.OnesCount32(cfg.ChannelMask); n > cfg.outputChannels() {
+		return nil, &ConfigError{Field: "ChannelMask", Err: fmt.Errorf("mask %#x names %d speakers for %d channels", cfg.ChannelMask, n, cfg.outputChannels())}
+	}
+	stream, err := backend().OpenStream(p.params, p.buffers...)
+	if err != nil {
+		return nil, fmt.Errorf("opening stream on '%s': %w", device.Name, err)
+	}
+
+	r := &Recorder{
+		cfg:         cfg,
+		device:      device,
+		stream:      stream,
+		params:      p.params,
+		buffers:     p.buffers,
+		monitor:     p.monitor,
+		sampleRate:  sampleRate,
+		outputRate:  sampleRate,
+		maxFrames:   int64(cfg.lengthLimit().Seconds() * sampleRate),
+		capped:      cfg.lengthLimit() != cfg.Duration,
+		splitFrames: int64(cfg.Split.Seconds() * sampleRate),
+		segment:     1,
+		out:         out,
+		seeker:      seekable(out),
+		stop:        make(chan struct{}),
+		finished:    make(chan struct{}),
+	}
+	r.SetVolume(cfg.Volume * fromDBFS(cfg.GainDB))
+	r.countdownLeft = int64(cfg.Countdown.Seconds() * sampleRate)
+	r.countdown.Store(r.countdownLeft)
+	r.byteOrder = cfg.byteOrder()
+	r.frame = make([]float64, 0, cfg.outputChannels())
+	if cfg.ResampleRate > 0 && cfg.ResampleRate != sampleRate {
+		r.outputRate = cfg.ResampleRate
+		r.resampler = newLinearResampler(sampleRate, cfg.ResampleRate, cfg.outputChannels(), r.writeFrame)
+	}
+	if cfg.Invert || len(cfg.InvertChannels) > 0 {
+		r.invert = make([]bool, cfg.Channels)
+		for ch := range r.invert {
+			r.invert[ch] = cfg.Invert
+		}
+		for _, ch := range cfg.InvertChannels {
+			r.invert[ch] = true
+		}
+	}
+	if cfg.DCBlock {
+		cutoff := cfg.DCBlockCutoff
+		if cutoff == 0 {
+			cutoff = defaultDCBlockCutoff
+		}
+		r.dcBlock = newDCBlocker(cutoff, sampleRate, cfg.outputChannels())
+	}
+	for i, f := range cfg.EQ {
+		if f.Freq >= sampleRate/2 {
+			stream.Close()
+			return nil, &ConfigError{Field: "EQ", Err: fmt.Errorf("filter %d: %.0f Hz is not below half the sample rate of %.0f Hz", i+1, f.Freq, sampleRate)}
+		}
+		r.eq = append(r.eq, newBiquad(f, sampleRate, cfg.outputChannels()))
+	}
+	if cfg.GateOpen != 0 {
+		r.gate = newNoiseGate(cfg.GateOpen, cfg.GateClose, cfg.GateAttack, cfg.GateRelease, sampleRate)
+	}
+	if cfg.LimitThreshold != 0 {
+		r.limiter = newLimiter(cfg.LimitThreshold, cfg.LimitRelease, r.outputRate, cfg.outputChannels())
+	}
+	if cfg.OnTone != nil {
+		if cfg.ToneFrequency >= sampleRate/2 {
+			stream.Close()
+			return nil, &ConfigError{Field: "ToneFrequency", Err: fmt.Errorf("%.0f Hz is not below half the sample rate of %.0f Hz", cfg.ToneFrequency, sampleRate)}
+		}
+		r.tone = newToneDetector(cfg.ToneFrequency, cfg.ToneThreshold, sampleRate)
+	}
+	if cfg.VAD {
+		r.preRoll.init(int(math.Ceil(cfg.VADPreRoll.Seconds() * sampleRate / float64(cfg.FramesPerBuffer))))
+	}
+	r.storeLevel(Level{Peak: minDBFS, RMS: minDBFS})
+	if cfg.Channels > 1 {
+		r.channelLevels = make([]levelCell, cfg.Channels)
+		for c := range r.channelLevels {
+			r.channelLevels[c].store(Level{Peak: minDBFS, RMS: minDBFS})
+		}
+	}
+	switch buf := p.buffers[0].(type) {
+	case []int16:
+		r.buffer = buf
+	case []int32:
+		r.buffer32 = buf
+	case []float32:
+		r.bufferF32 = buf
+	}
+	if cfg.Dither != "" && cfg.Dither != DitherNone {
+		switch {
+		case cfg.SampleFormat != PCMInt16:
+			logger().Info("Not dithering: float output keeps the samples as they are")
+		case cfg.outputBits() == 24 && r.captureBits() == 32:
+			// 24-bit output drops bits of what the device delivers.
+			r.dither = newDitherer(cfg.Dither, 1<<8, cfg.outputChannels())
+		case cfg.outputBits() == 16 && r.altersSamples():
+			// Scaled or processed samples fall between the 16-bit steps.
+			r.dither = newDitherer(cfg.Dither, 1, cfg.outputChannels())
+		default:
+			logger().Info("Not dithering: the output keeps the samples of the capture unchanged", "bits", cfg.outputBits())
+		}
+	}
+	return r, nil
+}
+
+// altersSamples reports whether captured samples reach the output other than
+// as they are: scaled by the initial volume, filtered, mixed together or
+// resampled.
+func (r *Recorder) altersSamples() bool {
+	cfg := r.cfg
+	mixes := cfg.ChannelMap == nil && !cfg.Planar &&
+		(cfg.Mix == MixMonoMix || cfg.Channels > 2 && (cfg.Mix == MixDefault || cfg.Mix == MixStereo))
+	return r.Volume() != 1 || mixes || r.dcBlock != nil || r.eq != nil || r.gate != nil || r.limiter != nil || r.resampler != nil
+}
+
+// streamPlan is the input stream a Config calls for, found by planStream.
+type streamPlan struct {
+	cfg     Config // With Channels resolved.
+	device  *portaudio.DeviceInfo
+	params  portaudio.StreamParameters
+	buffers []interface{} // The capture buffer, then the monitor buffer if any.
+	monitor []float32
+}
+
+// planStream selects the devices, the channel count and the sample rate for
+// cfg and checks that they can capture in its sample format, without opening
+// a stream.
+func planStream(cfg Config) (streamPlan, error) {
+	devices, err := backend().Devices()
+	if err != nil {
+		return streamPlan{}, fmt.Errorf("listing devices: %w", err)
+	}
+
+	for i, dev := range devices {
+		if dev.MaxInputChannels >= cfg.Channels {
+			logger().Info("Input device", "index", i, "name", dev.Name)
+		}
+	}
+
+	var device *portaudio.DeviceInfo
+	if cfg.Loopback {
+		device, err = findLoopback(devices, cfg.HostAPI, cfg.Device, max(1, cfg.Channels))
+	} else {
+		device, err = findDevice(devices, cfg.HostAPI, cfg.Device, max(1, cfg.Channels), input)
+	}
+	if err != nil {
+		return streamPlan{}, err
+	}
+	if cfg.Channels == AllChannels {
+		cfg.Channels = device.MaxInputChannels
+		// Settings that depend on the channel count are checked again.
+		if cfg, err = validateConfig(cfg); err != nil {
+			return streamPlan{}, err
+		}
+	}
+
+	inputParams := portaudio.StreamDeviceParameters{
+		Device:   device,
+		Channels: cfg.Channels,
+		Latency:  cfg.latency(device.DefaultLowInputLatency, device.DefaultHighInputLatency),
+	}
+	sampleRate, err := chooseSampleRate(device, cfg)
+	if err != nil {
+		// The device may reject every rate for another reason, such as the
+		// channel count, which the check at its default rate names.
+		probe := portaudio.StreamParameters{Input: inputParams, SampleRate: device.DefaultSampleRate}
+		if perr := checkStreamParams(probe, newStreamBuffer(cfg.SampleFormat, cfg.BitsPerSample, 0)); perr != nil && !errors.Is(perr, portaudio.InvalidSampleRate) {
+			return streamPlan{}, perr
+		}
+		return streamPlan{}, fmt.Errorf("no working sample rate found: %w", err)
+	}
+
+	if cfg.FramesPerBuffer > largeFramesPerBuffer {
+		logger().Warn("Large buffer adds latency", "framesPerBuffer", cfg.FramesPerBuffer, "latency", time.Duration(float64(cfg.FramesPerBuffer)/sampleRate*float64(time.Second)).Round(time.Millisecond))
+	}
+	streamBuf := newStreamBuffer(cfg.SampleFormat, cfg.BitsPerSample, cfg.FramesPerBuffer*cfg.Channels)
+
+	params := portaudio.StreamParameters{
+		Input:           inputParams,
+		SampleRate:      sampleRate,
+		FramesPerBuffer: cfg.FramesPerBuffer,
+	}
+
+	buffers := []interface{}{streamBuf}
+	var monitorBuf []float32
+	if cfg.Monitor {
+		if params.Output, err = monitorParams(devices, cfg); err != nil {
+			return streamPlan{}, err
+		}
+		monitorBuf = make([]float32, cfg.FramesPerBuffer*cfg.outputChannels())
+		buffers = append(buffers, monitorBuf)
+	}
+	if err := checkStreamParams(params, buffers...); err != nil {
+		return streamPlan{}, err
+	}
+	return streamPlan{cfg, device, params, buffers, monitorBuf}, nil
+}
+
+// Start writes the file header and begins capturing in the background.
+func (r *Recorder) Start() error {
+	if !r.appending {
+		if err := r.writeHeader(); err != nil {
+			return fmt.Errorf("writing header: %w", err)
+		}
+	}
+
+	if r.resampler != nil {
+		logger().Info("Recording", "device", r.device.Name, "channels", r.cfg.Channels, "sampleRate", r.sampleRate, "resampleRate", r.outputRate)
+	} else {
+		logger().Info("Recording", "device", r.device.Name, "channels", r.cfg.Channels, "sampleRate", r.sampleRate)
+	}
+	if err := r.stream.Start(); err != nil {
+		return fmt.Errorf("starting stream: %w", err)
+	}
+	if r.cfg.Verbose {
+		r.logStreamInfo()
+	}
+
+	r.started = true
+	r.startTime = time.Now().Add(r.cfg.Countdown + r.cfg.Prebuffer)
+	r.prebufferLeft = int64(r.cfg.Prebuffer.Seconds() * r.sampleRate)
+	if r.cfg.OnProgress != nil {
+		r.startProgress()
+	}
+	go r.loop()
+	return nil
+}
+
+// Stop ends the capture, finalizes the file header and releases the stream,
+// PortAudio and, if the Recorder created it, the output file. The header is
+// finalized even when the capture ended on an error, so that the audio
+// captured until then stays playable. It returns the error that ended the
+// capture early joined with any error finalizing the output. Calls after the
+// first only return that error again.
+func (r *Recorder) Stop() error {
+	r.stopOnce.Do(func() { r.stopErr = r.stopAndFinalize() })
+	return r.stopErr
+}
+
+func (r *Recorder) stopAndFinalize() error {
+	defer releasePortAudio()
+
+	if r.started {
+		close(r.stop)
+		<-r.finished
+		if r.stream != nil {
+			r.stream.Stop()
+		}
+		r.stopProgress()
+	}
+	r.closeStreams()
+	if r.stream != nil {
+		r.stream.Close()
+	}
+	if n := r.overflows.Load(); n > 0 {
+		logger().Warn("Input overflowed; the recording has gaps", "overflows", n)
+	}
+	if r.clips.input+r.clips.clamped > 0 {
+		logger().Warn("The recording clipped", "inputSamples", r.clips.input, "gainSamples", r.clips.clamped)
+	}
+
+	err := r.flushADPCM()
+	if err == nil {
+		err = r.finalizeHeader()
+	}
+	if err != nil {
+		err = fmt.Errorf("finalizing output: %w", err)
+	}
+	if r.outCloser != nil {
+		if cerr := r.outCloser.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("closing output: %w", cerr)
+		}
+	}
+	return errors.Join(r.loopErr, err)
+}
+
+// FramesCaptured returns the number of frames captured so far.
+func (r *Recorder) FramesCaptured() int64 {
+	return r.frames.Load()
+}
+
+// SampleRate returns the rate the device captures at, which differs from
+// the rate of the output when resampling.
+func (r *Recorder) SampleRate() float64 {
+	return r.sampleRate
+}
+
+// Overflows returns the number of times the device delivered audio faster
+// than it was consumed, each of which dropped some input.
+func (r *Recorder) Overflows() int64 {
+	return r.overflows.Load()
+}
+
+// BytesWritten returns the amount of sample data written so far, across all
+// files of a split recording.
+func (r *Recorder) BytesWritten() int64 {
+	return r.dataBytes.Load()
+}
+
+// Volume returns the gain currently applied to captured samples.
+func (r *Recorder) Volume() float64 {
+	return math.Float64frombits(r.volume.Load())
+}
+
+// SetVolume changes the gain applied to captured samples. It is safe to call
+// while recording and takes effect from the next sample on.
+func (r *Recorder) SetVolume(v float64) {
+	r.volume.Store(math.Float64bits(v))
+}
+
+// loop blocks in stream.Read and only checks for a stop request between
+// reads, so it sleeps while PortAudio has no frames for it. A stop therefore
+// takes effect after at most one more buffer.
+func (r *Recorder) loop() {
+	defer close(r.finished)
+	for {
+		if err := r.stream.Read(); err != nil {
+			if deviceLost(err) {
+				if r.cfg.Reconnect && r.reconnect() {
+					continue
+				}
+				r.loopErr = fmt.Errorf("reading from '%s': %w: %w", r.device.Name, ErrDeviceLost, err)
+				return
+			}
+			if !errors.Is(err, portaudio.InputOverflowed) {
+				r.loopErr = fmt.Errorf("reading from '%s': %w", r.device.Name, err)
+				return
+			}
+			// The buffer still holds the frames read after the overflow.
+			if r.overflows.Add(1) == 1 {
+				logger().Warn("Input overflowed, audio was dropped")
+			}
+		}
+		if r.prebufferLeft > 0 {
+			r.prebufferLeft -= int64(r.numSamples() / r.cfg.Channels)
+			select {
+			case <-r.stop:
+				return
+			default:
+			}
+			continue
+		}
+		if r.cfg.Verbose {
+			r.timeRead()
+		}
+		if r.cfg.Timestamps != nil {
+			r.readTime = time.Now()
+		}
+		if r.cfg.OnBuffer != nil {
+			r.cfg.OnBuffer(r.buffer, len(r.buffer)/r.cfg.Channels)
+		}
+		if r.tone != nil {
+			r.detectTone()
+		}
+		level := r.measureLevel()
+		r.storeLevel(level)
+		if r.channelLevels != nil {
+			r.storeChannelLevels()
+		}
+		if r.countdownLeft > 0 {
+			r.countDown(level)
+			select {
+			case <-r.stop:
+				return
+			default:
+			}
+			continue
+		}
+		if r.splitDue() {
+			if err := r.rotate(); err != nil {
+				r.loopErr = fmt.Errorf("starting next segment: %w", err)
+				return
+			}
+		}
+		if r.cfg.Timestamps != nil {
+			r.stampBuffer()
+		}
+		clamped := r.clips.clamped
+		if err := r.writeBuffer(level); err != nil {
+			r.loopErr = fmt.Errorf("writing output: %w", err)
+			return
+		}
+		r.checkClipping(r.clips.clamped - clamped)
+		if r.progress != nil {
+			r.reportProgress(level)
+		}
+		if err := r.playMonitor(); err != nil {
+			r.loopErr = fmt.Errorf("monitoring: %w", err)
+			return
+		}
+		if r.diskFull() {
+			return
+		}
+		if r.silenceTimedOut(level) {
+			logger().Info("Stopping after silence", "timeout", r.cfg.SilenceTimeout)
+			return
+		}
+
+		if r.maxFrames > 0 && r.framesCaptured >= r.maxFrames {
+			if r.capped {
+				logger().Warn("Stopping at the maximum duration", "maxDuration", r.cfg.MaxDuration)
+			}
+			return
+		}
+
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+	}
+}
+
+// writeBuffer encodes the captured buffer into the scratch buffer and writes
+// it to the output file in a single call, subject to voice-activity gating.
+// With a Duration set, the buffer is cut short at the exact frame where the
+// duration is reached.
+func (r *Recorder) writeBuffer(level Level) error {
+	r.scratch = r.scratch[:0]
+	ch := r.cfg.Channels
+	frames := r.numSamples() / ch
+	if r.maxFrames > 0 && r.framesCaptured+int64(frames) > r.maxFrames {
+		frames = int(r.maxFrames - r.framesCaptured)
+	}
+	for i := 0; i < frames*ch; i += ch {
+		frame := r.mixFrame(i)
+		r.processFrame(frame)
+		r.monitorFrame(i/ch, frame)
+		if r.resampler != nil {
+			r.resampler.push(frame)
+		} else {
+			r.writeFrame(frame)
+		}
+	}
+
+	r.framesCaptured += int64(frames)
+	r.frames.Store(r.framesCaptured)
+	if r.cfg.VAD {
+		return r.gateBuffer(level, frames)
+	}
+	return r.writeOut(r.scratch)
+}
+
+// writeFrame encodes one output frame into the scratch buffer.
+func (r *Recorder) writeFrame(frame []float64) {
+	if r.limiter != nil {
+		for _, s := range r.limiter.process(frame, r.Volume()) {
+			r.scratch = r.encodeSample(r.scratch, s)
+		}
+		return
+	}
+	for _, s := range frame {
+		r.writeSample(s)
+	}
+}
+
+// writeOut writes encoded sample data and accounts for it in the data size.
+func (r *Recorder) writeOut(b []byte) error {
+	if r.sizeLimitReached(len(b)) {
+		if err := r.rotate(); err != nil {
+			return fmt.Errorf("starting next file: %w", err)
+		}
+	}
+	if _, err := r.out.Write(b); err != nil {
+		return err
+	}
+	r.totalBytesWritten += int64(len(b))
+	r.fileFrames.Store(r.dataFrames(r.totalBytesWritten))
+	r.dataBytes.Add(int64(len(b)))
+	r.publish(b)
+	return nil
+}
+
+// numSamples is the number of samples in the capture buffer.
+func (r *Recorder) numSamples() int {
+	return len(r.buffer) + len(r.buffer32) + len(r.bufferF32)
+}
+
+// sample returns the i-th captured sample normalized to [-1, 1], with its
+// polarity flipped per Config.Invert.
+func (r *Recorder) sample(i int) float64 {
+	var s float64
+	switch {
+	case r.bufferF32 != nil:
+		s = float64(r.bufferF32[i])
+	case r.buffer32 != nil:
+		s = int32ToFloat64(r.buffer32[i])
+	default:
+		s = int16ToFloat64(r.buffer[i])
+	}
+	if r.invert != nil && r.invert[i%r.cfg.Channels] {
+		// The most negative integer sample lies just beyond -1.
+		s = min(-s, 1)
+	}
+	return s
+}
+
+func int16ToFloat64(s int16) float64 {
+	return float64(s) / float64(math.MaxInt16)
+}
+
+func int32ToFloat64(s int32) float64 {
+	return float64(s) / float64(math.MaxInt32)
+}
+
+// clampInt16 converts v to int16, saturating at the bounds of the type.
+func clampInt16(v float64) int16 {
+	if v >= math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v <= math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+// clampInt32 converts v to int32, saturating at the bounds of the type.
+func clampInt32(v float64) int32 {
+	if v >= math.MaxInt32 {
+		return math.MaxInt32
+	}
+	if v <= math.MinInt32 {
+		return math.MinInt32
+	}
+	return int32(v)
+}
+
+// checkStreamParams asks PortAudio whether the complete parameters of the
+// stream about to be opened are supported, so that a rejection names the
+// setting at fault rather than surfacing from OpenStream.
+func checkStreamParams(p portaudio.StreamParameters, buffers ...interface{}) error {
+	err := backend().IsFormatSupported(p, buffers...)
+	if err == nil {
+		return nil
+	}
+	var field string
+	switch {
+	case errors.Is(err, portaudio.InvalidChannelCount):
+		field = fmt.Sprintf("channel count %d", p.Input.Channels)
+		if p.Output.Device != nil {
+			field += fmt.Sprintf(" in, %d out", p.Output.Channels)
+		}
+	case errors.Is(err, portaudio.InvalidSampleRate):
+		field = fmt.Sprintf("sample rate %.0f Hz", p.SampleRate)
+	case errors.Is(err, portaudio.SampleFormatNotSupported):
+		field = fmt.Sprintf("sample format %T", buffers[0])
+	case errors.Is(err, portaudio.InvalidDevice), errors.Is(err, portaudio.DeviceUnavailable):
+		field = fmt.Sprintf("device %q", p.Input.Device.Name)
+	case errors.Is(err, portaudio.BadIODeviceCombination):
+		field = fmt.Sprintf("device pair %q and %q", p.Input.Device.Name, p.Output.Device.Name)
+	default:
+		field = fmt.Sprintf("parameters (%d channels at %.0f Hz, %v latency)", p.Input.Channels, p.SampleRate, p.Input.Latency)
+	}
+	return fmt.Errorf("unsupported stream %s: %w", field, err)
+}
+
+// newStreamBuffer returns a capture buffer of n samples whose element type
+// matches the sample format. Format probes use it with n == 0 so that they
+// ask PortAudio for the same sample type as the real stream.
+func newStreamBuffer(format SampleFormat, bitsPerSample, n int) interface{} {
+	switch {
+	case format == Float32:
+		return make([]float32, n)
+	case bitsPerSample == 16:
+		return make([]int16, n)
+	default:
+		return make([]int32, n)
+	}
+}
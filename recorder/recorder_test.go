@@ -0,0 +1,245 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// useFakeBackend makes a FakeBackend with the given input the backend of the
+// test, with the package's log messages discarded.
+func useFakeBackend(t testing.TB, channels int, sampleRate float64, samples []float64) *FakeBackend {
+	t.Helper()
+	b := NewFakeBackend(channels, sampleRate, samples)
+	SetBackend(b)
+	SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() {
+		SetBackend(nil)
+		SetLogger(nil)
+	})
+	return b
+}
+
+// record captures frames frames of the samples, interleaved in channels
+// input channels, through a 48 kHz FakeBackend with cfg, and returns the
+// file written.
+func record(t *testing.T, cfg Config, channels, frames int, samples []float64) []byte {
+	t.Helper()
+	useFakeBackend(t, channels, 48000, samples)
+	if cfg.Volume == 0 {
+		cfg.Volume = 1
+	}
+	// Rounded up, for the frame count to be truncated back to frames.
+	cfg.Duration = (time.Duration(frames)*time.Second + 47999) / 48000
+	var out MemBuffer
+	r, err := NewRecorderTo(cfg, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// pcm16 returns the FakeBackend sample captured as the 16-bit value v.
+func pcm16(v int16) float64 {
+	// Captured samples are truncated toward zero.
+	return (float64(v) + math.Copysign(0.5, float64(v))) / math.MaxInt16
+}
+
+// readWav parses the WAV file b and returns its reader and sample data.
+func readWav(t *testing.T, b []byte) (*WavReader, []byte) {
+	t.Helper()
+	w, err := NewWavReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, data
+}
+
+// int16s decodes little-endian 16-bit sample data.
+func int16s(data []byte) []int16 {
+	s := make([]int16, len(data)/2)
+	for i := range s {
+		s[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+	return s
+}
+
+func TestRecordSine(t *testing.T) {
+	const frames = 480
+	want := make([]int16, frames)
+	samples := make([]float64, frames)
+	for i := range want {
+		want[i] = int16(math.Round(16384 * math.Sin(2*math.Pi*1000*float64(i)/48000)))
+		samples[i] = pcm16(want[i])
+	}
+	b := record(t, Config{}, 1, frames, samples)
+
+	if len(b) != 44+2*frames {
+		t.Fatalf("file is %d bytes, want %d", len(b), 44+2*frames)
+	}
+	le := binary.LittleEndian
+	hdr := []byte("RIFF")
+	hdr = le.AppendUint32(hdr, 36+2*frames)
+	hdr = append(hdr, "WAVEfmt "...)
+	hdr = le.AppendUint32(hdr, 16)
+	hdr = le.AppendUint16(hdr, wavFormatPCM)
+	hdr = le.AppendUint16(hdr, 1)
+	hdr = le.AppendUint32(hdr, 48000)
+	hdr = le.AppendUint32(hdr, 96000)
+	hdr = le.AppendUint16(hdr, 2)
+	hdr = le.AppendUint16(hdr, 16)
+	hdr = append(hdr, "data"...)
+	hdr = le.AppendUint32(hdr, 2*frames)
+	if !bytes.Equal(b[:44], hdr) {
+		t.Errorf("header\n%x\nwant\n%x", b[:44], hdr)
+	}
+	got := int16s(b[44:])
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sample %d is %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDataSize(t *testing.T) {
+	// Two full buffers and a partial one.
+	const frames = 1200
+	samples := make([]float64, frames)
+	for i := range samples {
+		samples[i] = pcm16(int16(i))
+	}
+	b := record(t, Config{FramesPerBuffer: 512}, 1, frames, samples)
+
+	written := len(b) - 44
+	if written != 2*frames {
+		t.Errorf("%d bytes of sample data written, want %d", written, 2*frames)
+	}
+	if got := binary.LittleEndian.Uint32(b[40:]); got != uint32(written) {
+		t.Errorf("data chunk declares %d bytes, %d written", got, written)
+	}
+	if got := int16s(b[44:]); got[frames-1] != frames-1 {
+		t.Errorf("last sample %d, want %d", got[frames-1], frames-1)
+	}
+}
+
+// BenchmarkWriteBuffer measures encoding and writing a captured buffer, as
+// done once per read.
+func BenchmarkWriteBuffer(b *testing.B) {
+	useFakeBackend(b, 2, 48000, nil)
+	r, err := NewRecorderTo(Config{Channels: 2, Volume: 1}, io.Discard)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Stop()
+	for i := range r.buffer {
+		r.buffer[i] = int16(i * 61)
+	}
+	b.SetBytes(int64(2 * len(r.buffer)))
+	for b.Loop() {
+		if err := r.writeBuffer(Level{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkWriteBufferPerSample measures writing the same buffer with one
+// binary.Write per sample, as the capture loop once did, for comparison.
+func BenchmarkWriteBufferPerSample(b *testing.B) {
+	buf := make([]int16, 2*512)
+	for i := range buf {
+		buf[i] = int16(i * 61)
+	}
+	b.SetBytes(int64(2 * len(buf)))
+	for b.Loop() {
+		for _, s := range buf {
+			if err := binary.Write(io.Discard, binary.LittleEndian, clampInt16(int16ToFloat64(s)*math.MaxInt16)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestClampInt16(t *testing.T) {
+	for _, tt := range []struct {
+		in   float64
+		want int16
+	}{
+		{0, 0},
+		{1000.7, 1000},
+		{-1000.7, -1000},
+		{math.MaxInt16, math.MaxInt16},
+		{math.MaxInt16 - 1, math.MaxInt16 - 1},
+		{math.MaxInt16 + 1, math.MaxInt16},
+		{1e9, math.MaxInt16},
+		{math.MinInt16, math.MinInt16},
+		{math.MinInt16 + 1, math.MinInt16 + 1},
+		{math.MinInt16 - 1, math.MinInt16},
+		{-1e9, math.MinInt16},
+	} {
+		if got := clampInt16(tt.in); got != tt.want {
+			t.Errorf("clampInt16(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVolumeClips(t *testing.T) {
+	samples := []float64{pcm16(20000), pcm16(-20000), pcm16(1000)}
+	_, data := readWav(t, record(t, Config{Volume: 4}, 1, len(samples), samples))
+	if got, want := int16s(data), []int16{math.MaxInt16, math.MinInt16, 4000}; !slices.Equal(got, want) {
+		t.Errorf("samples %v, want %v", got, want)
+	}
+}
+
+// channelsBackend is a FakeBackend whose device only opens with the listed
+// channel counts, as some drivers do below their maximum.
+type channelsBackend struct {
+	*FakeBackend
+	supported []int
+}
+
+func (b channelsBackend) IsFormatSupported(p portaudio.StreamParameters, buffers ...interface{}) error {
+	if !slices.Contains(b.supported, p.Input.Channels) {
+		return portaudio.InvalidChannelCount
+	}
+	return b.FakeBackend.IsFormatSupported(p, buffers...)
+}
+
+func TestUnsupportedChannelCount(t *testing.T) {
+	useFakeBackend(t, 4, 48000, nil)
+	SetBackend(channelsBackend{NewFakeBackend(4, 48000, nil), []int{1, 2, 4}})
+	for _, tt := range []struct {
+		channels int
+		err      string // Empty if the recorder opens.
+	}{
+		{2, ""},
+		{4, ""},
+		{3, "unsupported stream channel count 3"},
+		{6, "has 4 input channels, 6 requested"},
+	} {
+		r, err := NewRecorderTo(Config{Channels: tt.channels, Volume: 1}, &MemBuffer{})
+		if err == nil {
+			r.Stop()
+		}
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%d channels: %v", tt.channels, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%d channels: got error %v, want %q", tt.channels, err, tt.err)
+		}
+	}
+}
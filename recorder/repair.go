@@ -0,0 +1,80 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// RepairWav rewrites the size fields of the WAV file at path to match its
+// length, as needed when a recording was killed before its header was
+// finalized or was captured from a pipe. The data chunk is assumed to run to
+// the end of the file, as in the files a Recorder writes until they are
+// finalized; files whose RIFF size matches their length, such as those with
+// cue points after the data, are left alone. It reports whether anything had
+// to be changed.
+func RepairWav(path string) (bool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	fixed, err := repairWav(f)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	return fixed, f.Close()
+}
+
+func repairWav(f *os.File) (bool, error) {
+	format, declared, err := readWavHeader(f)
+	if err == nil {
+		err = checkWavFormat(format)
+	}
+	if err != nil {
+		return false, err
+	}
+	dataStart, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	actual := info.Size() - dataStart
+	actual -= actual % int64(format.BlockAlign)
+	if actual > math.MaxUint32-int64(dataStart) {
+		return false, fmt.Errorf("%d bytes of sample data do not fit a WAV file", actual)
+	}
+	dataSize := uint32(actual)
+
+	var riff [4]byte
+	if _, err := f.ReadAt(riff[:], 4); err != nil {
+		return false, err
+	}
+	declaredRiff := binary.LittleEndian.Uint32(riff[:])
+	riffSize := uint32(dataStart-8) + dataSize + dataSize&1
+	if declared == dataSize && declaredRiff == riffSize {
+		return false, nil
+	}
+	if declared < dataSize && int64(declaredRiff)+8 == info.Size() {
+		return false, nil
+	}
+
+	layout := wavLayout{headerSize: int(dataStart), blockAlign: int(format.BlockAlign)}
+	// Extensible PCM files have a fact chunk as well.
+	if layout.factOffset, err = findFactCount(f, dataStart); err != nil {
+		return false, err
+	}
+	// updateWavHeader adds the pad byte of an odd-sized chunk at the current
+	// position.
+	if _, err := f.Seek(dataStart+actual, io.SeekStart); err != nil {
+		return false, err
+	}
+	logger().Info("Repairing WAV header", "declaredBytes", declared, "actualBytes", dataSize)
+	return true, updateWavHeader(f, layout, int64(dataSize), nil)
+}
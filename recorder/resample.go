@@ -0,0 +1,46 @@
+package recorder
+
+// linearResampler converts a stream of frames from one sample rate to another
+// by linear interpolation: every output frame lies at a fractional position
+// between two consecutive input frames and is their weighted average. There
+// is no anti-aliasing filter, so downsampling folds content above the new
+// Nyquist frequency back into the band; for speech captured at 44.1 or 48 kHz
+// and resampled to 16 kHz this is usually inaudible.
+type linearResampler struct {
+	step float64 // Input frames per output frame.
+	pos  float64 // Position of the next output frame after prev, in input frames.
+
+	prev     []float64
+	havePrev bool
+	out      []float64
+	emit     func([]float64)
+}
+
+func newLinearResampler(inRate, outRate float64, channels int, emit func([]float64)) *linearResampler {
+	return &linearResampler{
+		step: inRate / outRate,
+		prev: make([]float64, channels),
+		out:  make([]float64, channels),
+		emit: emit,
+	}
+}
+
+// push feeds one input frame and emits every output frame that falls between
+// the previous input frame and this one. The emitted slice is reused.
+func (l *linearResampler) push(frame []float64) {
+	if !l.havePrev {
+		copy(l.prev, frame)
+		l.havePrev = true
+		return
+	}
+
+	for l.pos < 1 {
+		for c := range l.out {
+			l.out[c] = l.prev[c] + (frame[c]-l.prev[c])*l.pos
+		}
+		l.emit(l.out)
+		l.pos += l.step
+	}
+	l.pos--
+	copy(l.prev, frame)
+}
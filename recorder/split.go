@@ -0,0 +1,120 @@
+package recorder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// segmentPath names the n-th file of a recording split by Config.Split or
+// Config.MaxSize, which starts at t. Splitting by time inserts the local
+// start time before the extension of OutputPath, splitting by size a
+// sequence number, e.g. rec-20240101-120500.wav or rec-001.wav.
+func segmentPath(cfg Config, t time.Time, n int) string {
+	ext := filepath.Ext(cfg.OutputPath)
+	name := strings.TrimSuffix(cfg.OutputPath, ext)
+	if cfg.Split > 0 {
+		name += t.Format("-20060102-150405")
+	}
+	if cfg.MaxSize > 0 {
+		name += fmt.Sprintf("-%03d", n)
+	}
+	return name + ext
+}
+
+// segmented reports whether the recording is spread over several files.
+func (cfg Config) segmented() bool {
+	return cfg.Split > 0 || cfg.MaxSize > 0
+}
+
+// splitDue reports whether the current segment has reached Config.Split.
+func (r *Recorder) splitDue() bool {
+	return r.splitFrames > 0 && r.framesCaptured-r.segmentStart >= r.splitFrames
+}
+
+// sizeLimitReached reports whether writing n more bytes of sample data would
+// take the current file beyond Config.MaxSize, counting the header and the
+// pad byte an odd-sized chunk may need. A file always receives at least one
+// buffer.
+func (r *Recorder) sizeLimitReached(n int) bool {
+	if r.cfg.MaxSize == 0 || r.totalBytesWritten == 0 {
+		return false
+	}
+	header := r.wavLayout.headerSize
+	switch r.cfg.Format {
+	case FormatRaw:
+		header = 0
+	case FormatAIFF:
+		header = aiffHeaderSize
+	}
+	return int64(header)+r.totalBytesWritten+int64(n)+1 > r.cfg.MaxSize
+}
+
+// rotate finalizes the current output file and continues the recording in a
+// new one with its own header. It runs between two buffers, so no frames are
+// lost at the boundary.
+func (r *Recorder) rotate() error {
+	err := r.finalizeHeader()
+	r.encoder = nil
+	if cerr := r.outCloser.Close(); err == nil {
+		err = cerr
+	}
+	r.outCloser, r.seeker = nil, nil
+	if err != nil {
+		return fmt.Errorf("finalizing segment: %w", err)
+	}
+
+	r.segment++
+	path := segmentPath(r.cfg, time.Now(), r.segment)
+	f, err := CreateOutput(path, r.cfg.Overwrite)
+	if err != nil {
+		return err
+	}
+	logger().Info("Continuing in next file", "path", path)
+	r.files = append(r.files, path)
+	r.diskPath = path
+	r.out, r.seeker, r.outCloser = f, seekable(f), f
+	r.totalBytesWritten = 0
+	r.fileFrames.Store(0)
+	r.segmentStart = r.framesCaptured
+	return r.writeHeader()
+}
+
+// expandPath replaces the strftime-style tokens %Y, %m, %d, %H, %M and %S in
+// path with the fields of t, and %% with a percent sign. Other tokens are an
+// error.
+func expandPath(path string, t time.Time) (string, error) {
+	if !strings.Contains(path, "%") {
+		return path, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] != '%' {
+			b.WriteByte(path[i])
+			continue
+		}
+		if i++; i == len(path) {
+			return "", fmt.Errorf("%q ends in a lone %%", path)
+		}
+		switch path[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case '%':
+			b.WriteByte('%')
+		default:
+			return "", fmt.Errorf("unknown token %%%c in %q; use %%Y, %%m, %%d, %%H, %%M, %%S or %%%%", path[i], path)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,160 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// DropPolicy decides what happens to captured audio when a reader returned by
+// Recorder.Stream falls behind and its buffer is full.
+type DropPolicy int
+
+const (
+	// BlockOnFull makes the capture loop wait for the reader. Nothing is lost
+	// from the stream, but a reader that stalls for long enough makes the
+	// device overflow, dropping audio from the file as well.
+	BlockOnFull DropPolicy = iota
+	// DropOnFull discards the buffer for that reader only and counts it in
+	// Recorder.StreamDrops. The file and other readers are unaffected.
+	DropOnFull
+)
+
+// defaultStreamBuffers is used when Config.StreamBuffers is zero.
+const defaultStreamBuffers = 16
+
+// Stream returns a reader yielding the encoded sample data as it is written
+// to the output, interleaved and without any header: little-endian PCM for
+// every format except AIFF, whose samples are big-endian. Up to
+// Config.StreamBuffers captured buffers are queued for the reader before
+// Config.StreamDropPolicy applies. The reader returns io.EOF once the
+// Recorder is stopped and the queue is drained. Closing it detaches it from
+// the Recorder.
+func (r *Recorder) Stream() io.ReadCloser {
+	size := r.cfg.StreamBuffers
+	if size <= 0 {
+		size = defaultStreamBuffers
+	}
+	s := &pcmStream{
+		r:    r,
+		ch:   make(chan []byte, size),
+		done: make(chan struct{}),
+	}
+
+	r.streamsMu.Lock()
+	defer r.streamsMu.Unlock()
+	if r.streamsClosed {
+		close(s.ch)
+	} else {
+		r.streams = append(r.streams, s)
+	}
+	return s
+}
+
+// StreamInfo describes the sample data yielded by Stream.
+type StreamInfo struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	Float         bool       // IEEE float samples rather than integer PCM.
+	Codec         FileFormat // FormatALaw, FormatULaw or FormatADPCM for coded samples; empty for linear ones.
+	BigEndian     bool
+}
+
+// StreamInfo returns the layout of the sample data yielded by Stream.
+func (r *Recorder) StreamInfo() StreamInfo {
+	info := StreamInfo{
+		SampleRate:    int(r.outputRate),
+		Channels:      r.cfg.outputChannels(),
+		BitsPerSample: r.cfg.outputBits(),
+		Float:         r.cfg.SampleFormat == Float32,
+		BigEndian:     r.byteOrder == binary.BigEndian,
+	}
+	if r.cfg.Format.coded() {
+		info.Codec = r.cfg.Format
+	}
+	return info
+}
+
+// StreamDrops returns the number of buffers discarded across all readers
+// returned by Stream under DropOnFull.
+func (r *Recorder) StreamDrops() int64 {
+	return r.streamDrops.Load()
+}
+
+// publish hands a copy of b to every attached stream.
+func (r *Recorder) publish(b []byte) {
+	r.streamsMu.Lock()
+	defer r.streamsMu.Unlock()
+	for _, s := range r.streams {
+		buf := append([]byte(nil), b...)
+		if r.cfg.StreamDropPolicy == DropOnFull {
+			select {
+			case s.ch <- buf:
+			default:
+				r.streamDrops.Add(1)
+			}
+			continue
+		}
+		select {
+		case s.ch <- buf:
+		case <-s.done:
+		}
+	}
+}
+
+// closeStreams ends every attached stream once no more data will be
+// published.
+func (r *Recorder) closeStreams() {
+	r.streamsMu.Lock()
+	defer r.streamsMu.Unlock()
+	for _, s := range r.streams {
+		close(s.ch)
+	}
+	r.streams = nil
+	r.streamsClosed = true
+}
+
+type pcmStream struct {
+	r         *Recorder
+	ch        chan []byte
+	cur       []byte
+	done      chan struct{} // Closed by Close.
+	closeOnce sync.Once
+}
+
+func (s *pcmStream) Read(p []byte) (int, error) {
+	for len(s.cur) == 0 {
+		select {
+		case b, ok := <-s.ch:
+			if !ok {
+				return 0, io.EOF
+			}
+			s.cur = b
+		case <-s.done:
+			return 0, io.ErrClosedPipe
+		}
+	}
+	n := copy(p, s.cur)
+	s.cur = s.cur[n:]
+	return n, nil
+}
+
+// Close detaches the stream. Closing done first releases a capture loop
+// blocked on this stream before the stream list lock is taken.
+func (s *pcmStream) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+
+		r := s.r
+		r.streamsMu.Lock()
+		defer r.streamsMu.Unlock()
+		for i, other := range r.streams {
+			if other == s {
+				r.streams = append(r.streams[:i], r.streams[i+1:]...)
+				break
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,50 @@
+package recorder
+
+import "time"
+
+// RecordingSummary describes a finished recording, for scripts that consume
+// it as JSON.
+type RecordingSummary struct {
+	Start         time.Time  `json:"start"`
+	Device        string     `json:"device"`
+	SampleRate    float64    `json:"sampleRate"` // Of the output, after any resampling.
+	Channels      int        `json:"channels"`
+	BitsPerSample int        `json:"bitsPerSample"`
+	Duration      float64    `json:"durationSeconds"`
+	Bytes         int64      `json:"bytes"` // Sample data written, before any encoding.
+	Output        string     `json:"output"`
+	Files         []string   `json:"files,omitempty"` // Set when the output was split.
+	Format        FileFormat `json:"format"`
+	Overflows     int64      `json:"overflows"`
+	InputClips    int64      `json:"inputClips"` // Samples the input delivered at full scale.
+	GainClips     int64      `json:"gainClips"`  // Samples clamped to full scale after gain.
+	Title         string     `json:"title,omitempty"`
+	Artist        string     `json:"artist,omitempty"`
+	Comment       string     `json:"comment,omitempty"`
+}
+
+// Summary describes the recording so far; it is meant to be called once the
+// Recorder is stopped.
+func (r *Recorder) Summary() RecordingSummary {
+	s := RecordingSummary{
+		Start:         r.startTime,
+		Device:        r.device.Name,
+		SampleRate:    r.outputRate,
+		Channels:      r.cfg.outputChannels(),
+		BitsPerSample: r.cfg.outputBits(),
+		Duration:      float64(r.FramesCaptured()) / r.sampleRate,
+		Bytes:         r.dataBytes.Load(),
+		Output:        r.cfg.OutputPath,
+		Format:        r.cfg.Format,
+		Overflows:     r.Overflows(),
+		InputClips:    r.clips.input,
+		GainClips:     r.clips.clamped,
+		Title:         r.cfg.Title,
+		Artist:        r.cfg.Artist,
+		Comment:       r.cfg.Comment,
+	}
+	if r.cfg.segmented() {
+		s.Files = r.files
+	}
+	return s
+}
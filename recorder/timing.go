@@ -0,0 +1,110 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// timingLogInterval is how often Config.Verbose logs the stream clock.
+	timingLogInterval = 10 * time.Second
+	// timestampInterval is the audio between entries of Config.Timestamps.
+	timestampInterval = time.Second
+)
+
+// timestamp is an entry of Config.Timestamps in JSON.
+type timestamp struct {
+	Frame      int64     `json:"frame"`
+	Time       time.Time `json:"time"`
+	StreamTime float64   `json:"streamTime"`
+}
+
+// readTimer tracks the wall-clock time between successive reads for
+// Config.Verbose.
+type readTimer struct {
+	last   time.Time // Of the previous read; zero before the first.
+	since  time.Time // Start of the current logging interval.
+	reads  int
+	maxGap time.Duration
+}
+
+// logStreamInfo logs the latencies and rate the stream actually runs with,
+// which may differ from those requested.
+func (r *Recorder) logStreamInfo() {
+	info := r.stream.Info()
+	if info == nil {
+		logger().Info("Stream timing unavailable")
+		return
+	}
+	attrs := []any{"inputLatency", info.InputLatency, "sampleRate", info.SampleRate, "framesPerBuffer", r.cfg.FramesPerBuffer}
+	if r.monitor != nil {
+		attrs = append(attrs, "outputLatency", info.OutputLatency)
+	}
+	logger().Info("Stream timing", attrs...)
+}
+
+// timeRead notes a read that has just returned. A read returning more than
+// two buffers' worth of time after the previous one is logged as a stall;
+// the stream clock and the longest gap are logged every timingLogInterval.
+func (r *Recorder) timeRead() {
+	now := time.Now()
+	t := &r.readTimer
+	if t.last.IsZero() {
+		t.last, t.since = now, now
+		return
+	}
+	gap := now.Sub(t.last)
+	t.last = now
+	t.reads++
+	t.maxGap = max(t.maxGap, gap)
+	if buf := r.framesDuration(int64(r.cfg.FramesPerBuffer)); gap > 2*buf {
+		logger().Warn("Read stalled", "gap", gap, "buffer", buf)
+	}
+	if elapsed := now.Sub(t.since); elapsed >= timingLogInterval {
+		logger().Info("Stream clock", "streamTime", r.stream.Time(), "captured", r.framesDuration(r.framesCaptured),
+			"reads", t.reads, "meanGap", elapsed/time.Duration(t.reads), "maxGap", t.maxGap)
+		t.since, t.reads, t.maxGap = now, 0, 0
+	}
+}
+
+// stampBuffer writes the entry of Config.Timestamps for the buffer about to
+// be written, at most one every timestampInterval. The first frame of the
+// buffer reached the device the input latency plus the buffer's own length
+// before the read returned. A failed write stops the timestamps with a
+// warning rather than the recording.
+func (r *Recorder) stampBuffer() {
+	if r.framesCaptured < r.nextStamp {
+		return
+	}
+	first := r.nextStamp == 0
+	r.nextStamp = r.framesCaptured + int64(timestampInterval.Seconds()*r.sampleRate)
+	at := r.readTime.Add(-r.framesDuration(int64(r.numSamples() / r.cfg.Channels)))
+	if info := r.stream.Info(); info != nil {
+		at = at.Add(-info.InputLatency)
+	}
+	ts := timestamp{r.framesCaptured, at, r.stream.Time().Seconds()}
+
+	var err error
+	w := r.cfg.Timestamps
+	switch {
+	case r.cfg.TimestampJSON:
+		err = json.NewEncoder(w).Encode(ts)
+	case first:
+		_, err = fmt.Fprintf(w, "frame,time,streamTime\n")
+		fallthrough
+	default:
+		if err == nil {
+			_, err = fmt.Fprintf(w, "%d,%s,%.6f\n", ts.Frame, ts.Time.Format(time.RFC3339Nano), ts.StreamTime)
+		}
+	}
+	if err != nil {
+		logger().Warn("Writing timestamps failed; no more are written", "err", err)
+		r.cfg.Timestamps = nil
+	}
+}
+
+// framesDuration returns the length of n frames at the capture rate.
+func (r *Recorder) framesDuration(n int64) time.Duration {
+	return time.Duration(float64(n) / r.sampleRate * float64(time.Second))
+}
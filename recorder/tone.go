@@ -0,0 +1,68 @@
+package recorder
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// defaultToneThreshold is Config.ToneThreshold if zero.
+	defaultToneThreshold = -30.0
+
+	// toneDebounce is how long after a detection the same tone is not
+	// reported again, so that a held tone fires OnTone once.
+	toneDebounce = 500 * time.Millisecond
+)
+
+// toneDetector looks for a single frequency in each buffer with the Goertzel
+// algorithm, which costs one multiply-add per sample instead of a full FFT.
+type toneDetector struct {
+	freq      float64
+	coeff     float64
+	threshold float64 // dBFS.
+	debounce  int64   // Frames.
+	last      int64   // Frame at which the tone was last reported; -1 if never.
+}
+
+func newToneDetector(freq, threshold, sampleRate float64) *toneDetector {
+	if threshold == 0 {
+		threshold = defaultToneThreshold
+	}
+	return &toneDetector{
+		freq:      freq,
+		coeff:     2 * math.Cos(2*math.Pi*freq/sampleRate),
+		threshold: threshold,
+		debounce:  int64(toneDebounce.Seconds() * sampleRate),
+		last:      -1,
+	}
+}
+
+// detectTone runs the detector over the captured buffer, averaging the input
+// channels, and calls Config.OnTone if the tone reaches the threshold.
+func (r *Recorder) detectTone() {
+	d := r.tone
+	ch := r.cfg.Channels
+	frames := r.numSamples() / ch
+	if frames == 0 {
+		return
+	}
+	var s1, s2 float64
+	for i := 0; i < frames; i++ {
+		x := 0.0
+		for c := 0; c < ch; c++ {
+			x += r.sample(i*ch + c)
+		}
+		s1, s2 = x/float64(ch)+d.coeff*s1-s2, s1
+	}
+	// A full-scale sine at the target frequency has a power of (N/2)^2.
+	power := s1*s1 + s2*s2 - d.coeff*s1*s2
+	level := toDBFS(2 * math.Sqrt(math.Max(power, 0)) / float64(frames))
+	if level < d.threshold {
+		return
+	}
+	if d.last >= 0 && r.framesCaptured-d.last < d.debounce {
+		return
+	}
+	d.last = r.framesCaptured
+	r.cfg.OnTone(d.freq, level)
+}
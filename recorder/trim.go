@@ -0,0 +1,129 @@
+package recorder
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// defaultTrimMargin is the audio kept on either side of the trimmed data
+// when Config.TrimMargin is zero, so that soft attacks and decays survive.
+const defaultTrimMargin = 100 * time.Millisecond
+
+// trim removes the leading and trailing frames of the current file whose
+// samples all stay below Config.SilenceThreshold, keeping TrimMargin of
+// audio around the rest. The kept data is moved to the start of the data
+// chunk and the file truncated after it, so like normalize it needs an
+// output that can read, seek and truncate. The file is left positioned at
+// the end of the data.
+func (r *Recorder) trim() error {
+	rws, ok := r.out.(io.ReadWriteSeeker)
+	t, canTruncate := r.out.(interface{ Truncate(int64) error })
+	if !ok || !canTruncate || r.seeker == nil || r.encoder != nil {
+		logger().Warn("Skipping trimming: the output cannot be rewritten")
+		return nil
+	}
+	end, err := rws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	start := end - r.totalBytesWritten
+	size := r.cfg.BitsPerSample / 8
+	frameSize := int64(size * r.cfg.outputChannels())
+	buf := make([]byte, normalizeChunk/frameSize*frameSize)
+	threshold := fromDBFS(r.cfg.SilenceThreshold)
+	frames := (end - start) / frameSize
+
+	// loud returns the index of the first or, if last is set, the last frame
+	// of b holding a sample at or above the threshold, or -1.
+	loud := func(b []byte, last bool) int64 {
+		n := int64(len(b)) / frameSize
+		for i := range n {
+			f := i
+			if last {
+				f = n - 1 - i
+			}
+			for j := f * frameSize; j < (f+1)*frameSize; j += int64(size) {
+				if math.Abs(r.decodeSample(b[j:])) >= threshold {
+					return f
+				}
+			}
+		}
+		return -1
+	}
+
+	first := int64(-1)
+	for pos := start; pos < end && first < 0; pos += int64(len(buf)) {
+		b := buf[:min(int64(len(buf)), end-pos)]
+		if err := readAt(rws, pos, b); err != nil {
+			return err
+		}
+		if f := loud(b, false); f >= 0 {
+			first = (pos-start)/frameSize + f
+		}
+	}
+	if first < 0 {
+		logger().Warn("Skipping trimming: nothing reaches the silence threshold", "thresholdDBFS", r.cfg.SilenceThreshold)
+		return nil
+	}
+	last := first
+	for pos := end; pos > start; {
+		n := min(int64(len(buf)), pos-start)
+		pos -= n
+		if err := readAt(rws, pos, buf[:n]); err != nil {
+			return err
+		}
+		if f := loud(buf[:n], true); f >= 0 {
+			last = (pos-start)/frameSize + f
+			break
+		}
+	}
+
+	margin := r.cfg.TrimMargin
+	if margin == 0 {
+		margin = defaultTrimMargin
+	}
+	m := int64(margin.Seconds() * r.outputRate)
+	head := max(0, first-m)
+	tail := min(frames, last+1+m)
+	if head == 0 && tail == frames {
+		return nil
+	}
+	seconds := func(n int64) time.Duration { return time.Duration(float64(n) / r.outputRate * float64(time.Second)) }
+	logger().Info("Trimming silence", "head", seconds(head), "tail", seconds(frames-tail))
+
+	// The kept data only ever moves towards the start, so copying it in
+	// order never overwrites what is still to be read.
+	src, dst := start+head*frameSize, start
+	for src < start+tail*frameSize {
+		b := buf[:min(int64(len(buf)), start+tail*frameSize-src)]
+		if err := readAt(rws, src, b); err != nil {
+			return err
+		}
+		if _, err := rws.Seek(dst, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := rws.Write(b); err != nil {
+			return err
+		}
+		src += int64(len(b))
+		dst += int64(len(b))
+	}
+	if err := t.Truncate(dst); err != nil {
+		return err
+	}
+	r.totalBytesWritten = dst - start
+	r.fileFrames.Store(tail - head)
+	r.shiftMarkers(head, tail-head)
+	_, err = rws.Seek(dst, io.SeekStart)
+	return err
+}
+
+// readAt fills b from offset pos of rs.
+func readAt(rs io.ReadSeeker, pos int64, b []byte) error {
+	if _, err := rs.Seek(pos, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.ReadFull(rs, b)
+	return err
+}
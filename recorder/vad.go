@@ -0,0 +1,63 @@
+package recorder
+
+// gateBuffer implements voice-activity gating for the encoded buffer in
+// r.scratch. Voiced buffers are written together with any buffered pre-roll
+// and start a post-roll countdown; unvoiced buffers are written while the
+// post-roll lasts and otherwise kept in the pre-roll ring, from which the
+// oldest ones are dropped.
+func (r *Recorder) gateBuffer(level Level, frames int) error {
+	if level.RMS >= r.cfg.SilenceThreshold {
+		if err := r.preRoll.drain(r.writeOut); err != nil {
+			return err
+		}
+		r.postRollFrames = int64(r.cfg.VADPostRoll.Seconds() * r.sampleRate)
+		return r.writeOut(r.scratch)
+	}
+
+	if r.postRollFrames > 0 {
+		r.postRollFrames -= int64(frames)
+		return r.writeOut(r.scratch)
+	}
+
+	r.preRoll.push(r.scratch)
+	return nil
+}
+
+// byteRing keeps copies of the last few pushed byte slices, oldest first.
+type byteRing struct {
+	bufs  [][]byte
+	start int // Index of the oldest entry.
+	n     int // Number of valid entries.
+}
+
+func (b *byteRing) init(size int) {
+	b.bufs = make([][]byte, size)
+	b.start, b.n = 0, 0
+}
+
+// push stores a copy of p, evicting the oldest entry when the ring is full.
+func (b *byteRing) push(p []byte) {
+	if len(b.bufs) == 0 {
+		return
+	}
+	i := (b.start + b.n) % len(b.bufs)
+	if b.n == len(b.bufs) {
+		b.start = (b.start + 1) % len(b.bufs)
+	} else {
+		b.n++
+	}
+	b.bufs[i] = append(b.bufs[i][:0], p...)
+}
+
+// drain passes the stored entries to fn in the order they were pushed and
+// empties the ring.
+func (b *byteRing) drain(fn func([]byte) error) error {
+	for b.n > 0 {
+		if err := fn(b.bufs[b.start]); err != nil {
+			return err
+		}
+		b.start = (b.start + 1) % len(b.bufs)
+		b.n--
+	}
+	return nil
+}
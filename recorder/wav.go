@@ -0,0 +1,451 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatIEEEFloat  = 3
+	wavFormatExtensible = 0xFFFE
+
+	// wavExtensibleSize is the size of the WAVE_FORMAT_EXTENSIBLE extension
+	// of the fmt chunk, including its own size field.
+	wavExtensibleSize = 24
+)
+
+// wavSubFormatGUID is the KSDATAFORMAT_SUBTYPE GUID of WAVE_FORMAT_EXTENSIBLE
+// sub-formats, in file byte order, with the format tag in its first two
+// bytes.
+var wavSubFormatGUID = [16]byte{0, 0, 0, 0, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
+// defaultChannelMasks are the speaker positions of WAVE_FORMAT_EXTENSIBLE
+// files by channel count: mono, stereo, 2.1, quad, 4.1, 5.1, 6.1 and 7.1.
+var defaultChannelMasks = [...]uint32{0x4, 0x3, 0xB, 0x33, 0x3B, 0x3F, 0x13F, 0x63F}
+
+// DefaultChannelMask returns the speaker mask used for channels channels
+// when Config.ChannelMask is zero, itself zero for unusual counts.
+func DefaultChannelMask(channels int) uint32 {
+	if channels < 1 || channels > len(defaultChannelMasks) {
+		return 0
+	}
+	return defaultChannelMasks[channels-1]
+}
+
+// extensibleFormat returns the fmt chunk of a WAVE_FORMAT_EXTENSIBLE file of
+// the given sub-format, with its extension: cbSize, the valid bits per
+// sample, the channel mask and the sub-format GUID.
+func extensibleFormat(tag uint16, sampleRate, channels, bitsPerSample int, mask uint32) (wavFormat, []byte) {
+	blockAlign := channels * bitsPerSample / 8
+	format := wavFormat{
+		AudioFormat:   wavFormatExtensible,
+		NumChannels:   uint16(channels),
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * blockAlign),
+		BlockAlign:    uint16(blockAlign),
+		BitsPerSample: uint16(bitsPerSample),
+	}
+	ext := binary.LittleEndian.AppendUint16(nil, wavExtensibleSize-2)
+	ext = binary.LittleEndian.AppendUint16(ext, uint16(bitsPerSample))
+	ext = binary.LittleEndian.AppendUint32(ext, mask)
+	guid := wavSubFormatGUID
+	binary.LittleEndian.PutUint16(guid[:], tag)
+	return format, append(ext, guid[:]...)
+}
+
+// extensibleSubFormat returns the format tag held in the sub-format GUID of
+// a WAVE_FORMAT_EXTENSIBLE extension.
+func extensibleSubFormat(ext [wavExtensibleSize]byte) (uint16, bool) {
+	guid := ext[8:]
+	if string(guid[2:]) != string(wavSubFormatGUID[2:]) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint16(guid), true
+}
+
+// extensible reports whether the output needs a WAVE_FORMAT_EXTENSIBLE fmt
+// chunk to be described fully: it has more than two channels, samples wider
+// than 16 bits or an explicit channel mask.
+func (cfg Config) extensible() bool {
+	return (cfg.Format == FormatWAV || cfg.Format == FormatWAV64) && (cfg.outputChannels() > 2 || cfg.BitsPerSample > 16 || cfg.ChannelMask != 0)
+}
+
+type wavHeader struct {
+	ChunkID       [4]byte
+	ChunkSize     uint32
+	Format        [4]byte
+	Subchunk1ID   [4]byte
+	Subchunk1Size uint32
+	AudioFormat   uint16
+	NumChannels   uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+// unknownDataSize is declared as the RIFF and data chunk sizes of a stream
+// whose header cannot be patched afterwards. Most players then read until
+// EOF.
+const unknownDataSize = 0xFFFFFFFF
+
+// wavLayout records where writeWavHeader put the fields that
+// updateWavHeader patches.
+type wavLayout struct {
+	headerSize     int   // Bytes before the sample data.
+	factOffset     int64 // Offset of the fact chunk's sample count; zero if absent.
+	blockAlign     int
+	framesPerBlock int   // Of block-coded formats; zero means one.
+	padFrames      int   // Silence completing the last block, left out of the fact chunk.
+	ds64Offset     int64 // Offset of the payload of the JUNK chunk reserved for ds64; zero if absent.
+}
+
+// ds64Size is the payload of an RF64 ds64 chunk: the 64-bit RIFF and data
+// sizes, the sample count and an empty table of other chunk sizes.
+const ds64Size = 28
+
+// writeWavHeader writes a header declaring dataSize bytes of sample data,
+// with the encoded chunks in extra placed between the fmt and data chunks.
+// Formats other than plain PCM also get a fact chunk with the number of
+// frames. Seekable outputs start with zero and have updateWavHeader patch the
+// sizes once the amount of data is known; unseekable outputs such as pipes
+// get unknownDataSize instead.
+func writeWavHeader(w io.Writer, audioFormat uint16, sampleRate, numChannels, bitsPerSample int, dataSize uint32, extra []byte) (wavLayout, error) {
+	return writeWavHeaderFormat(w, pcmFormat(audioFormat, sampleRate, numChannels, bitsPerSample), nil, 1, dataSize, extra)
+}
+
+// pcmFormat returns the fmt chunk of linear or G.711 samples.
+func pcmFormat(audioFormat uint16, sampleRate, numChannels, bitsPerSample int) wavFormat {
+	blockAlign := numChannels * bitsPerSample / 8
+	return wavFormat{
+		AudioFormat:   audioFormat,
+		NumChannels:   uint16(numChannels),
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * blockAlign),
+		BlockAlign:    uint16(blockAlign),
+		BitsPerSample: uint16(bitsPerSample),
+	}
+}
+
+// writeWavHeaderFormat is writeWavHeader for an explicit fmt chunk, with ext
+// appended to its fixed part and blocks of framesPerBlock frames each.
+func writeWavHeaderFormat(w io.Writer, format wavFormat, ext []byte, framesPerBlock int, dataSize uint32, extra []byte) (wavLayout, error) {
+	layout, b := wavHeaderBytes(format, ext, framesPerBlock, dataSize, extra)
+	_, err := w.Write(b)
+	return layout, err
+}
+
+// writeRF64Header is writeWavHeaderFormat with a JUNK chunk of ds64Size
+// bytes ahead of the fmt chunk. Readers skip it, so the file is a plain WAV
+// until updateWavHeader finds the data past the 32-bit sizes and turns the
+// JUNK chunk into the ds64 chunk of an RF64 file.
+func writeRF64Header(w io.Writer, format wavFormat, ext []byte, framesPerBlock int, dataSize uint32, extra []byte) (wavLayout, error) {
+	layout, b := wavHeaderBytes(format, ext, framesPerBlock, dataSize, extra)
+	junk := appendChunk(nil, "JUNK", make([]byte, ds64Size))
+	b = slices.Insert(b, 12, junk...)
+	if riffSize := binary.LittleEndian.Uint32(b[4:]); riffSize != unknownDataSize {
+		binary.LittleEndian.PutUint32(b[4:], riffSize+uint32(len(junk)))
+	}
+	layout.headerSize += len(junk)
+	if layout.factOffset != 0 {
+		layout.factOffset += int64(len(junk))
+	}
+	layout.ds64Offset = 12 + 8
+	_, err := w.Write(b)
+	return layout, err
+}
+
+// wavHeaderBytes returns the header writeWavHeaderFormat writes.
+func wavHeaderBytes(format wavFormat, ext []byte, framesPerBlock int, dataSize uint32, extra []byte) (wavLayout, []byte) {
+	layout := wavLayout{blockAlign: int(format.BlockAlign), framesPerBlock: framesPerBlock}
+	fmtSize := binary.Size(wavHeader{}) + len(ext)
+	if format.AudioFormat != wavFormatPCM {
+		frames := uint32(unknownDataSize)
+		if dataSize != unknownDataSize {
+			frames = dataSize / uint32(format.BlockAlign) * uint32(framesPerBlock)
+		}
+		layout.factOffset = int64(fmtSize) + 8
+		extra = append(appendChunk(nil, "fact", binary.LittleEndian.AppendUint32(nil, frames)), extra...)
+	}
+	layout.headerSize = fmtSize + len(extra) + 8
+	chunkSize := uint32(layout.headerSize-8) + dataSize + dataSize&1
+	if dataSize == unknownDataSize {
+		chunkSize = unknownDataSize
+	}
+	hdr := wavHeader{
+		ChunkID:       [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     chunkSize,
+		Format:        [4]byte{'W', 'A', 'V', 'E'},
+		Subchunk1ID:   [4]byte{'f', 'm', 't', ' '},
+		Subchunk1Size: uint32(16 + len(ext)),
+		AudioFormat:   format.AudioFormat,
+		NumChannels:   format.NumChannels,
+		SampleRate:    format.SampleRate,
+		ByteRate:      format.ByteRate,
+		BlockAlign:    format.BlockAlign,
+		BitsPerSample: format.BitsPerSample,
+	}
+	b, _ := binary.Append(nil, binary.LittleEndian, hdr)
+	b = append(b, ext...)
+	b = append(b, extra...)
+	b = append(b, 'd', 'a', 't', 'a')
+	b = binary.LittleEndian.AppendUint32(b, dataSize)
+	return layout, b
+}
+
+// appendChunk appends a RIFF chunk holding payload to b, padded to an even
+// size as RIFF requires.
+func appendChunk(b []byte, id string, payload []byte) []byte {
+	b = append(b, id...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(payload)))
+	b = append(b, payload...)
+	if len(payload)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// seekable returns w as an io.WriteSeeker if it supports seeking. Files such
+// as os.Stdout implement Seek even when attached to a pipe, so the method is
+// probed rather than trusted.
+func seekable(w io.Writer) io.WriteSeeker {
+	ws, ok := w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	if _, err := ws.Seek(0, io.SeekCurrent); err != nil {
+		return nil
+	}
+	return ws
+}
+
+// WriteStreamHeader writes a WAV header for the sample data yielded by
+// Recorder.Stream, with unknown sizes as for a pipe.
+func WriteStreamHeader(w io.Writer, info StreamInfo) error {
+	return writeStreamHeader(w, info, unknownDataSize)
+}
+
+// WriteWav writes data, sample data as yielded by Recorder.Stream, as a
+// complete WAV file.
+func WriteWav(w io.Writer, info StreamInfo, data []byte) error {
+	if int64(len(data)) > unknownDataSize-1<<10 {
+		return fmt.Errorf("%d bytes of sample data do not fit a WAV file", len(data))
+	}
+	if err := writeStreamHeader(w, info, uint32(len(data))); err != nil {
+		return err
+	}
+	if len(data)%2 == 1 {
+		data = append(data[:len(data):len(data)], 0)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func writeStreamHeader(w io.Writer, info StreamInfo, dataSize uint32) error {
+	if info.BigEndian {
+		return errors.New("big-endian samples cannot be wrapped in WAV")
+	}
+	format := uint16(wavFormatPCM)
+	switch {
+	case info.Float:
+		format = wavFormatIEEEFloat
+	case info.Codec == FormatALaw:
+		format = wavFormatALaw
+	case info.Codec == FormatULaw:
+		format = wavFormatULaw
+	case info.Codec == FormatADPCM:
+		f, ext := adpcmFormat(info.SampleRate, info.Channels)
+		_, err := writeWavHeaderFormat(w, f, ext, adpcmFramesPerBlock(info.Channels, int(f.BlockAlign)), dataSize, nil)
+		return err
+	}
+	_, err := writeWavHeader(w, format, info.SampleRate, info.Channels, info.BitsPerSample, dataSize, nil)
+	return err
+}
+
+// updateWavHeader patches the sizes, and the frame count of a fact chunk, in
+// a header written by writeWavHeader. The file must be positioned at the end
+// of the sample data, where the pad byte of an odd-sized data chunk is
+// written, followed by trailer, which holds any chunks that come after the
+// data.
+//
+// Sizes past the 32-bit fields of RIFF are declared as unknownDataSize. A
+// header from writeRF64Header then becomes an RF64 one, with the real sizes
+// in its ds64 chunk; any other header is left for readers to take to EOF.
+func updateWavHeader(w io.WriteSeeker, layout wavLayout, dataSize int64, trailer []byte) error {
+	riffSize := int64(layout.headerSize-8) + dataSize
+	if dataSize%2 == 1 {
+		trailer = append([]byte{0}, trailer...)
+	}
+	if len(trailer) > 0 {
+		if _, err := w.Write(trailer); err != nil {
+			return err
+		}
+		riffSize += int64(len(trailer))
+	}
+	var frames int64
+	if layout.blockAlign > 0 {
+		frames = dataSize/int64(layout.blockAlign)*int64(max(1, layout.framesPerBlock)) - int64(layout.padFrames)
+	}
+	if riffSize >= unknownDataSize {
+		if layout.ds64Offset == 0 {
+			logger().Warn("The data exceeds the 4 GiB limit of WAV; its size is declared unknown", "bytes", dataSize)
+		} else if err := writeDS64(w, layout.ds64Offset, riffSize, dataSize, frames); err != nil {
+			return err
+		}
+		riffSize, dataSize, frames = unknownDataSize, unknownDataSize, unknownDataSize
+	}
+	if _, err := w.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(riffSize)); err != nil {
+		return err
+	}
+	if layout.factOffset != 0 {
+		if _, err := w.Seek(layout.factOffset, io.SeekStart); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, uint32(frames)); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Seek(int64(layout.headerSize-4), io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, uint32(dataSize))
+}
+
+// writeDS64 turns the header written by writeRF64Header into an RF64 one:
+// it retags the file and fills in the ds64 chunk at offset with the 64-bit
+// sizes. The 32-bit fields are left to the caller.
+func writeDS64(w io.WriteSeeker, offset, riffSize, dataSize, frames int64) error {
+	if _, err := w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte("RF64")); err != nil {
+		return err
+	}
+	if _, err := w.Seek(offset-8, io.SeekStart); err != nil {
+		return err
+	}
+	b := binary.LittleEndian.AppendUint32([]byte("ds64"), ds64Size)
+	for _, v := range []int64{riffSize, dataSize, frames} {
+		b = binary.LittleEndian.AppendUint64(b, uint64(v))
+	}
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	_, err := w.Write(b)
+	return err
+}
+
+// writeSample scales the normalized sample s by the current volume and
+// appends it to the scratch buffer encoded at the configured bit depth, in the
+// byte order of the output format.
+// Integer samples are clamped to the range of their type so that gain clips
+// instead of wrapping around. 24-bit samples are derived from the full-scale
+// 32-bit value by dropping the lowest byte.
+func (r *Recorder) writeSample(s float64) {
+	r.scratch = r.encodeSample(r.scratch, s*r.Volume())
+}
+
+// decodeSample returns the sample encoded at the start of b, as written by
+// writeSample, normalized to [-1, 1].
+func (r *Recorder) decodeSample(b []byte) float64 {
+	order := r.byteOrder.(binary.ByteOrder)
+	switch {
+	case r.cfg.SampleFormat == Float32:
+		return float64(math.Float32frombits(order.Uint32(b)))
+	case r.cfg.BitsPerSample == 16:
+		return int16ToFloat64(int16(order.Uint16(b)))
+	case r.cfg.BitsPerSample == 24:
+		var v uint32
+		if order == binary.BigEndian {
+			v = uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8
+		} else {
+			v = uint32(b[2])<<24 | uint32(b[1])<<16 | uint32(b[0])<<8
+		}
+		return int32ToFloat64(int32(v))
+	default:
+		return int32ToFloat64(int32(order.Uint32(b)))
+	}
+}
+
+// encodeSample appends s to b in the output encoding.
+func (r *Recorder) encodeSample(b []byte, s float64) []byte {
+	if s > 1 || s < -1 {
+		r.clips.clamped++
+	}
+	switch {
+	case r.cfg.Format == FormatADPCM:
+		return r.adpcm.push(b, clampInt16(s*math.MaxInt16))
+	case r.cfg.Format == FormatALaw:
+		return append(b, linearToALaw(clampInt16(s*math.MaxInt16)))
+	case r.cfg.Format == FormatULaw:
+		return append(b, linearToULaw(clampInt16(s*math.MaxInt16)))
+	case r.cfg.SampleFormat == Float32:
+		s = math.Max(-1, math.Min(1, s))
+		return r.byteOrder.AppendUint32(b, math.Float32bits(float32(s)))
+	case r.cfg.BitsPerSample == 16:
+		x := s * math.MaxInt16
+		if r.dither != nil {
+			x = r.dither.quantize(x)
+		}
+		return r.byteOrder.AppendUint16(b, uint16(clampInt16(x)))
+	case r.cfg.BitsPerSample == 24:
+		x := s * math.MaxInt32
+		if r.dither != nil {
+			// The low byte of the 32-bit value is dropped.
+			x = r.dither.quantize(x)
+		}
+		v := clampInt32(x) >> 8
+		if r.byteOrder == binary.BigEndian {
+			return append(b, byte(v>>16), byte(v>>8), byte(v))
+		}
+		return append(b, byte(v), byte(v>>8), byte(v>>16))
+	default:
+		return r.byteOrder.AppendUint32(b, uint32(clampInt32(s*math.MaxInt32)))
+	}
+}
+
+// infoChunk returns the encoded LIST/INFO chunk for the tags in cfg, or nil
+// if none is set.
+func (cfg Config) infoChunk(created time.Time) []byte {
+	if cfg.Title == "" && cfg.Artist == "" && cfg.Comment == "" {
+		return nil
+	}
+	list := []byte("INFO")
+	for _, tag := range []struct{ id, text string }{
+		{"INAM", cfg.Title},
+		{"IART", cfg.Artist},
+		{"ICMT", cfg.Comment},
+		{"ICRD", created.Format("2006-01-02")},
+	} {
+		if tag.text != "" {
+			// INFO strings are NUL-terminated.
+			list = appendChunk(list, tag.id, append([]byte(tag.text), 0))
+		}
+	}
+	return appendChunk(nil, "LIST", list)
+}
+
+// wavFormatTag returns the format tag of the fmt chunk for cfg.
+func (cfg Config) wavFormatTag() uint16 {
+	switch cfg.Format {
+	case FormatALaw:
+		return wavFormatALaw
+	case FormatULaw:
+		return wavFormatULaw
+	}
+	return wavFormatTag(cfg.SampleFormat)
+}
+
+func wavFormatTag(format SampleFormat) uint16 {
+	if format == Float32 {
+		return wavFormatIEEEFloat
+	}
+	return wavFormatPCM
+}
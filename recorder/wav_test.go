@@ -0,0 +1,179 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestWavHeader(t *testing.T) {
+	const frames = 480
+	for _, tt := range []struct {
+		name       string
+		cfg        Config
+		channels   int
+		tag        uint16 // Of the fmt chunk.
+		format     SampleFormat
+		bits       int
+		headerSize int
+	}{
+		{"16-bit", Config{}, 1, wavFormatPCM, PCMInt16, 16, 44},
+		{"16-bit stereo", Config{Channels: 2}, 2, wavFormatPCM, PCMInt16, 16, 44},
+		{"24-bit", Config{BitsPerSample: 24}, 1, wavFormatExtensible, PCMInt16, 24, 80},
+		{"32-bit", Config{BitsPerSample: 32}, 1, wavFormatExtensible, PCMInt16, 32, 80},
+		{"float", Config{SampleFormat: Float32}, 1, wavFormatExtensible, Float32, 32, 80},
+		{"extensible", Config{Channels: 2, ChannelMask: 0x3}, 2, wavFormatExtensible, PCMInt16, 16, 80},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := record(t, tt.cfg, tt.channels, frames, nil)
+			blockAlign := tt.channels * tt.bits / 8
+			dataSize := frames * blockAlign
+			if len(b) != tt.headerSize+dataSize {
+				t.Fatalf("file is %d bytes, want %d", len(b), tt.headerSize+dataSize)
+			}
+			le := binary.LittleEndian
+			if string(b[0:4]) != "RIFF" || string(b[8:16]) != "WAVEfmt " {
+				t.Fatalf("header starts %q", b[:16])
+			}
+			if got := le.Uint32(b[4:]); got != uint32(len(b)-8) {
+				t.Errorf("RIFF size %d, want %d", got, len(b)-8)
+			}
+			for _, f := range []struct {
+				name      string
+				got, want uint32
+			}{
+				{"format tag", uint32(le.Uint16(b[20:])), uint32(tt.tag)},
+				{"channels", uint32(le.Uint16(b[22:])), uint32(tt.channels)},
+				{"sample rate", le.Uint32(b[24:]), 48000},
+				{"byte rate", le.Uint32(b[28:]), uint32(48000 * blockAlign)},
+				{"block align", uint32(le.Uint16(b[32:])), uint32(blockAlign)},
+				{"bits per sample", uint32(le.Uint16(b[34:])), uint32(tt.bits)},
+				{"data size", le.Uint32(b[tt.headerSize-4:]), uint32(dataSize)},
+			} {
+				if f.got != f.want {
+					t.Errorf("%s %d, want %d", f.name, f.got, f.want)
+				}
+			}
+			if id := string(b[tt.headerSize-8 : tt.headerSize-4]); id != "data" {
+				t.Errorf("data chunk ID %q", id)
+			}
+
+			w, data := readWav(t, b)
+			if w.SampleRate() != 48000 || w.Channels() != tt.channels || w.BitsPerSample() != tt.bits || w.Format() != tt.format {
+				t.Errorf("read %d Hz, %d channels, %d bits, format %d", w.SampleRate(), w.Channels(), w.BitsPerSample(), w.Format())
+			}
+			if n, ok := w.DataSize(); !ok || n != int64(dataSize) || len(data) != dataSize {
+				t.Errorf("data size %d, %v with %d bytes read, want %d", n, ok, len(data), dataSize)
+			}
+		})
+	}
+}
+
+func TestUpdateWavHeader(t *testing.T) {
+	var buf MemBuffer
+	layout, err := writeWavHeader(&buf, wavFormatPCM, 48000, 2, 16, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := bytes.Clone(buf.Bytes())
+	data := make([]byte, 1000)
+	if _, err := buf.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateWavHeader(&buf, layout, int64(len(data)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	after := buf.Bytes()
+	if len(after) != len(before)+len(data) {
+		t.Fatalf("file is %d bytes, want %d", len(after), len(before)+len(data))
+	}
+	want := bytes.Clone(before)
+	binary.LittleEndian.PutUint32(want[4:], 36+1000)
+	binary.LittleEndian.PutUint32(want[40:], 1000)
+	if !bytes.Equal(after[:len(before)], want) {
+		t.Errorf("patched header\n%x\nwant\n%x", after[:len(before)], want)
+	}
+}
+
+// chunk returns the payload of the first chunk of the WAV file b with the
+// given ID, or nil.
+func chunk(b []byte, id string) []byte {
+	for i := 12; i+8 <= len(b); {
+		size := int(binary.LittleEndian.Uint32(b[i+4:]))
+		if string(b[i:i+4]) == id {
+			return b[i+8 : min(len(b), i+8+size)]
+		}
+		i += 8 + size + size&1
+	}
+	return nil
+}
+
+func TestFactChunk(t *testing.T) {
+	const frames = 1000
+	for _, tt := range []struct {
+		name string
+		cfg  Config
+	}{
+		{"float", Config{SampleFormat: Float32, Channels: 2}},
+		{"A-law", Config{Format: FormatALaw}},
+		{"24-bit", Config{BitsPerSample: 24}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := record(t, tt.cfg, max(1, tt.cfg.Channels), frames, nil)
+			fact := chunk(b, "fact")
+			if len(fact) != 4 {
+				t.Fatalf("fact chunk %x, want a 4-byte sample count", fact)
+			}
+			if n := binary.LittleEndian.Uint32(fact); n != frames {
+				t.Errorf("fact chunk counts %d samples, want %d", n, frames)
+			}
+		})
+	}
+	b := record(t, Config{}, 1, frames, nil)
+	if chunk(b, "fact") != nil {
+		t.Error("PCM file has a fact chunk")
+	}
+}
+
+func TestExtensibleFmtChunk(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		cfg      Config
+		channels int
+		tag      uint16 // Of the sub-format.
+		bits     int
+		mask     uint32
+	}{
+		{"24-bit stereo", Config{Channels: 2, BitsPerSample: 24}, 2, wavFormatPCM, 24, 0x3},
+		{"float 5.1", Config{Channels: 6, SampleFormat: Float32, ChannelMap: []int{0, 1, 2, 3, 4, 5}}, 6, wavFormatIEEEFloat, 32, 0x3F},
+		{"explicit mask", Config{Channels: 2, ChannelMask: 0x600}, 2, wavFormatPCM, 16, 0x600},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := record(t, tt.cfg, tt.channels, 48, nil)
+			f := chunk(b, "fmt ")
+			if len(f) != 16+wavExtensibleSize {
+				t.Fatalf("fmt chunk is %d bytes, want %d", len(f), 16+wavExtensibleSize)
+			}
+			le := binary.LittleEndian
+			if tag := le.Uint16(f); tag != wavFormatExtensible {
+				t.Errorf("format tag %#x, want WAVE_FORMAT_EXTENSIBLE", tag)
+			}
+			if n := le.Uint16(f[16:]); n != 22 {
+				t.Errorf("cbSize %d, want 22", n)
+			}
+			if bits := le.Uint16(f[18:]); int(bits) != tt.bits {
+				t.Errorf("%d valid bits, want %d", bits, tt.bits)
+			}
+			if mask := le.Uint32(f[20:]); mask != tt.mask {
+				t.Errorf("channel mask %#x, want %#x", mask, tt.mask)
+			}
+			// KSDATAFORMAT_SUBTYPE_PCM or _IEEE_FLOAT:
+			// 0000000X-0000-0010-8000-00AA00389B71.
+			guid := []byte{byte(tt.tag), 0, 0, 0, 0, 0, 0x10, 0, 0x80, 0, 0, 0xAA, 0, 0x38, 0x9B, 0x71}
+			if !bytes.Equal(f[24:40], guid) {
+				t.Errorf("sub-format GUID %x, want %x", f[24:40], guid)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// wavFormat is the fixed part of a WAV fmt chunk.
+type wavFormat struct {
+	AudioFormat   uint16
+	NumChannels   uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+// WavReader reads the sample data of a WAV file.
+type WavReader struct {
+	c        io.Closer // Nil for readers from NewWavReader.
+	format   wavFormat
+	dataSize uint32
+	data     io.Reader
+}
+
+// OpenWav opens the WAV file at path and parses its header, leaving the
+// reader at the start of the sample data. Chunks other than fmt and data are
+// skipped. Integer PCM and IEEE float files are accepted.
+func OpenWav(path string) (*WavReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWavReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	w.c = f
+	return w, nil
+}
+
+// NewWavReader is like OpenWav but reads the WAV stream from r, such as a
+// MemBuffer a Recorder wrote to.
+func NewWavReader(r io.Reader) (*WavReader, error) {
+	format, dataSize, err := readWavHeader(r)
+	if err == nil {
+		err = checkWavFormat(format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WavReader{format: format, dataSize: dataSize, data: r}
+	if dataSize != unknownDataSize {
+		w.data = io.LimitReader(r, int64(dataSize))
+	}
+	return w, nil
+}
+
+func (w *WavReader) SampleRate() int    { return int(w.format.SampleRate) }
+func (w *WavReader) Channels() int      { return int(w.format.NumChannels) }
+func (w *WavReader) BitsPerSample() int { return int(w.format.BitsPerSample) }
+
+// Format reports whether the file holds integer PCM or float samples.
+func (w *WavReader) Format() SampleFormat {
+	if w.format.AudioFormat == wavFormatIEEEFloat {
+		return Float32
+	}
+	return PCMInt16
+}
+
+// DataSize returns the size of the data chunk declared in the header, or
+// false if the header leaves it unknown, as for a recording written to a
+// pipe.
+func (w *WavReader) DataSize() (int64, bool) {
+	if w.dataSize == unknownDataSize {
+		return 0, false
+	}
+	return int64(w.dataSize), true
+}
+
+// Read reads interleaved little-endian sample data. It returns io.EOF at the
+// end of the data chunk.
+func (w *WavReader) Read(p []byte) (int, error) {
+	return w.data.Read(p)
+}
+
+func (w *WavReader) Close() error {
+	if w.c == nil {
+		return nil
+	}
+	return w.c.Close()
+}
+
+// readWavHeader parses the RIFF header of r up to the start of the data
+// chunk, skipping chunks other than fmt by their declared size. It returns
+// the format and the declared data size.
+func readWavHeader(r io.Reader) (wavFormat, uint32, error) {
+	var format wavFormat
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return format, 0, truncated("RIFF header", err)
+	}
+	// RF64 files declare their sizes unknown and keep the real ones in a ds64
+	// chunk; reading them to EOF is just as good.
+	if (string(riff[0:4]) != "RIFF" && string(riff[0:4]) != "RF64") || string(riff[8:12]) != "WAVE" {
+		return format, 0, errors.New("not a RIFF/WAVE file")
+	}
+
+	haveFormat := false
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return format, 0, errors.New("no data chunk")
+			}
+			return format, 0, truncated("chunk header", err)
+		}
+		id := string(hdr[0:4])
+		size := binary.LittleEndian.Uint32(hdr[4:8])
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return format, 0, fmt.Errorf("fmt chunk is %d bytes, want at least 16", size)
+			}
+			if err := binary.Read(r, binary.LittleEndian, &format); err != nil {
+				return format, 0, truncated("fmt chunk", err)
+			}
+			size -= 16
+			haveFormat = true
+			if format.AudioFormat == wavFormatExtensible {
+				if size < wavExtensibleSize {
+					return format, 0, errors.New("fmt chunk lacks the WAVE_FORMAT_EXTENSIBLE extension")
+				}
+				var ext [wavExtensibleSize]byte
+				if _, err := io.ReadFull(r, ext[:]); err != nil {
+					return format, 0, truncated("fmt chunk", err)
+				}
+				size -= wavExtensibleSize
+				tag, ok := extensibleSubFormat(ext)
+				if !ok {
+					return format, 0, errors.New("unsupported WAVE_FORMAT_EXTENSIBLE sub-format")
+				}
+				// The rest of the package only needs the sub-format.
+				format.AudioFormat = tag
+			}
+		case "data":
+			if !haveFormat {
+				return format, 0, errors.New("data chunk before fmt chunk")
+			}
+			return format, size, nil
+		}
+		// Chunks are padded to an even size.
+		if _, err := io.CopyN(io.Discard, r, int64(size)+int64(size&1)); err != nil {
+			return format, 0, truncated(fmt.Sprintf("%q chunk", id), err)
+		}
+	}
+}
+
+func truncated(what string, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("truncated %s", what)
+	}
+	return fmt.Errorf("reading %s: %w", what, err)
+}
+
+func checkWavFormat(format wavFormat) error {
+	bits := int(format.BitsPerSample)
+	switch format.AudioFormat {
+	case wavFormatPCM:
+		if bits != 8 && bits != 16 && bits != 24 && bits != 32 {
+			return fmt.Errorf("unsupported PCM depth of %d bits", bits)
+		}
+	case wavFormatIEEEFloat:
+		if bits != 32 && bits != 64 {
+			return fmt.Errorf("unsupported float depth of %d bits", bits)
+		}
+	case wavFormatALaw, wavFormatULaw:
+		if bits != 8 {
+			return fmt.Errorf("unsupported G.711 depth of %d bits", bits)
+		}
+	default:
+		return fmt.Errorf("unsupported WAV format tag %d", format.AudioFormat)
+	}
+	channels := int(format.NumChannels)
+	if channels == 0 || int(format.BlockAlign) != channels*bits/8 {
+		return fmt.Errorf("invalid block alignment %d for %d channels of %d bits", format.BlockAlign, channels, bits)
+	}
+	if format.SampleRate == 0 {
+		return errors.New("sample rate is zero")
+	}
+	return nil
+}
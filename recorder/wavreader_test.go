@@ -0,0 +1,103 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNewWavReader(t *testing.T) {
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	extFormat, ext24 := extensibleFormat(wavFormatPCM, 96000, 2, 24, 0x3)
+	list := appendChunk(nil, "LIST", []byte("INFOodd"))
+	for _, tt := range []struct {
+		name     string
+		write    func(w io.Writer, dataSize uint32) error
+		rate     int
+		channels int
+		bits     int
+		format   SampleFormat
+	}{
+		{"16-bit stereo", func(w io.Writer, n uint32) error {
+			_, err := writeWavHeader(w, wavFormatPCM, 44100, 2, 16, n, nil)
+			return err
+		}, 44100, 2, 16, PCMInt16},
+		{"float", func(w io.Writer, n uint32) error {
+			_, err := writeWavHeader(w, wavFormatIEEEFloat, 48000, 1, 32, n, nil)
+			return err
+		}, 48000, 1, 32, Float32},
+		{"extensible", func(w io.Writer, n uint32) error {
+			_, err := writeWavHeaderFormat(w, extFormat, ext24, 1, n, nil)
+			return err
+		}, 96000, 2, 24, PCMInt16},
+		{"odd-sized chunk", func(w io.Writer, n uint32) error {
+			_, err := writeWavHeader(w, wavFormatPCM, 8000, 1, 16, n, list)
+			return err
+		}, 8000, 1, 16, PCMInt16},
+		{"RF64 reserve", func(w io.Writer, n uint32) error {
+			_, err := writeRF64Header(w, pcmFormat(wavFormatPCM, 48000, 2, 16), nil, 1, n, nil)
+			return err
+		}, 48000, 2, 16, PCMInt16},
+	} {
+		for _, known := range []bool{true, false} {
+			size := uint32(len(data))
+			if !known {
+				size = unknownDataSize
+			}
+			var buf bytes.Buffer
+			if err := tt.write(&buf, size); err != nil {
+				t.Fatal(err)
+			}
+			buf.Write(data)
+			if known {
+				// Trailing chunks are not sample data.
+				buf.Write(list)
+			}
+
+			w, err := NewWavReader(&buf)
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			if w.SampleRate() != tt.rate || w.Channels() != tt.channels || w.BitsPerSample() != tt.bits || w.Format() != tt.format {
+				t.Errorf("%s: %d Hz, %d channels, %d bits, format %d", tt.name, w.SampleRate(), w.Channels(), w.BitsPerSample(), w.Format())
+			}
+			if n, ok := w.DataSize(); ok != known || (known && n != int64(len(data))) {
+				t.Errorf("%s: data size %d, %v", tt.name, n, ok)
+			}
+			if got, err := io.ReadAll(w); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%s: read %v, %v, want %v", tt.name, got, err, data)
+			}
+		}
+	}
+}
+
+func TestNewWavReaderErrors(t *testing.T) {
+	var valid bytes.Buffer
+	if err := WriteWav(&valid, StreamInfo{SampleRate: 48000, Channels: 1, BitsPerSample: 16}, make([]byte, 8)); err != nil {
+		t.Fatal(err)
+	}
+	fmtFirst := valid.Bytes()
+	dataFirst := append(append([]byte("RIFF\x00\x00\x00\x00WAVE"), fmtFirst[36:]...), fmtFirst[12:36]...)
+	depth12 := bytes.Clone(fmtFirst)
+	binary.LittleEndian.PutUint16(depth12[34:], 12)
+	for _, tt := range []struct {
+		name string
+		b    []byte
+		err  string
+	}{
+		{"empty", nil, "truncated RIFF header"},
+		{"not RIFF", []byte("RIFX\x00\x00\x00\x00WAVEfmt "), "not a RIFF/WAVE file"},
+		{"truncated fmt", fmtFirst[:30], "truncated fmt chunk"},
+		{"no data", fmtFirst[:36], "no data chunk"},
+		{"data first", dataFirst, "data chunk before fmt chunk"},
+		{"12-bit", depth12, "unsupported PCM depth of 12 bits"},
+	} {
+		_, err := NewWavReader(bytes.NewReader(tt.b))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package recorder
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// WrapRaw writes the headerless sample data in the file at src, laid out as
+// info describes, to a new WAV file at dst, which is replaced only if
+// overwrite is set and must not be src itself. The source must hold whole
+// frames of little-endian 16-, 24- or 32-bit integer or 32-bit float
+// samples. A dst left incomplete by an error is removed.
+func WrapRaw(src, dst string, info StreamInfo, overwrite bool) error {
+	switch {
+	case info.SampleRate <= 0 || info.Channels < 1:
+		return fmt.Errorf("%s: invalid layout of %d channels at %d Hz", src, info.Channels, info.SampleRate)
+	case info.BigEndian || info.Codec != "":
+		return fmt.Errorf("%s: only little-endian linear PCM can be wrapped", src)
+	case info.Float && info.BitsPerSample != 32:
+		return fmt.Errorf("%s: float samples must be 32-bit", src)
+	case info.BitsPerSample != 16 && info.BitsPerSample != 24 && info.BitsPerSample != 32:
+		return fmt.Errorf("%s: unsupported bit depth %d", src, info.BitsPerSample)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	st, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	blockAlign := int64(info.Channels * info.BitsPerSample / 8)
+	if st.Size()%blockAlign != 0 {
+		return fmt.Errorf("%s: %d bytes are not a whole number of %d-byte frames", src, st.Size(), blockAlign)
+	}
+	if st.Size() > unknownDataSize-1<<10 {
+		return fmt.Errorf("%s: %d bytes of sample data do not fit a WAV file", src, st.Size())
+	}
+	if dstSt, err := os.Stat(dst); err == nil && os.SameFile(st, dstSt) {
+		return fmt.Errorf("%s: cannot wrap a file into itself", src)
+	}
+	dataSize := uint32(st.Size())
+
+	out, err := CreateOutput(dst, overwrite)
+	if err != nil {
+		return err
+	}
+	if err := writeWrapped(out, in, info, dataSize); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return fmt.Errorf("%s: %w", dst, err)
+	}
+	return nil
+}
+
+// writeWrapped writes the WAV header and the dataSize bytes of samples from
+// in to out and closes out.
+func writeWrapped(out *os.File, in io.Reader, info StreamInfo, dataSize uint32) error {
+	tag := uint16(wavFormatPCM)
+	if info.Float {
+		tag = wavFormatIEEEFloat
+	}
+	layout, err := writeWavHeader(out, tag, info.SampleRate, info.Channels, info.BitsPerSample, dataSize, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	// Writes the pad byte that odd-sized data needs.
+	if err := updateWavHeader(out, layout, int64(dataSize), nil); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,48 @@
+package recorder
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrapRaw(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "take.raw")
+	data := []byte{1, 0, 2, 0, 3, 0, 4, 0}
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info := StreamInfo{SampleRate: 48000, Channels: 2, BitsPerSample: 16}
+	dst := filepath.Join(dir, "take.wav")
+	if err := WrapRaw(src, dst, info, false); err != nil {
+		t.Fatal(err)
+	}
+	w, err := OpenWav(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if w.Channels() != 2 || w.SampleRate() != 48000 {
+		t.Errorf("wrapped as %d channels at %d Hz", w.Channels(), w.SampleRate())
+	}
+	if n, _ := w.DataSize(); n != int64(len(data)) {
+		t.Errorf("data size %d, want %d", n, len(data))
+	}
+}
+
+func TestWrapRawIntoItself(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "take.wav")
+	data := []byte{1, 0, 2, 0, 3, 0, 4, 0}
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info := StreamInfo{SampleRate: 48000, Channels: 1, BitsPerSample: 16}
+	if err := WrapRaw(src, src, info, true); err == nil {
+		t.Fatal("wrapping a file into itself succeeded")
+	}
+	if got, err := os.ReadFile(src); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("source is %v, %v after the rejected wrap, want %v", got, err, data)
+	}
+}
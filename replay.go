@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"audio-grab/recorder"
+)
+
+// replayRing keeps the most recent samples of a recording, overwriting the
+// oldest once it is full.
+type replayRing struct {
+	mu       sync.Mutex
+	buf      []int16
+	head     int   // Where the next sample goes.
+	written  int64 // Samples ever written.
+	channels int
+}
+
+func newReplayRing(d time.Duration, sampleRate, channels int) *replayRing {
+	frames := max(1, int(d.Seconds()*float64(sampleRate)))
+	return &replayRing{buf: make([]int16, frames*channels), channels: channels}
+}
+
+func (r *replayRing) write(s []int16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.written += int64(len(s))
+	if len(s) >= len(r.buf) {
+		// Only the tail survives; it fills the ring from the start.
+		copy(r.buf, s[len(s)-len(r.buf):])
+		r.head = 0
+		return
+	}
+	n := copy(r.buf[r.head:], s)
+	copy(r.buf, s[n:])
+	r.head = (r.head + len(s)) % len(r.buf)
+}
+
+// snapshot returns the samples held, oldest first, as whole frames.
+func (r *replayRing) snapshot() []int16 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// A read may have ended mid-frame, leaving part of a frame at the end.
+	partial := int(r.written % int64(r.channels))
+	if r.written < int64(len(r.buf)) {
+		return append([]int16(nil), r.buf[:r.head-partial]...)
+	}
+	// The oldest sample is the one the head is about to overwrite. As the
+	// ring holds whole frames, a partial frame at the end means the one at
+	// the start lost its beginning.
+	s := append(append([]int16(nil), r.buf[r.head:]...), r.buf[:r.head]...)
+	if partial > 0 {
+		s = s[r.channels-partial : len(s)-partial]
+	}
+	return s
+}
+
+// recordReplay captures into a ring holding the last d of audio, writing
+// nothing until s is pressed, which saves the ring's contents to a WAV file
+// named after cfg.OutputPath and the time of the keypress.
+func recordReplay(ctx context.Context, cfg recorder.Config, d time.Duration, opts options) error {
+	if cfg.OutputPath == "-" {
+		return errors.New("-replay-buffer saves to files, not stdout")
+	}
+	if cfg.SampleFormat == recorder.Float32 || cfg.BitsPerSample != 16 {
+		return errors.New("-replay-buffer needs 16-bit integer samples")
+	}
+	out := cfg.OutputPath
+	cfg.OutputPath, cfg.Format, cfg.Append = "", recorder.FormatRaw, false
+	cfg.Split, cfg.MaxSize = 0, 0
+	r, err := recorder.NewRecorderTo(cfg, io.Discard)
+	if err != nil {
+		return err
+	}
+	if opts.metricsAddr != "" {
+		ms, err := serveMetrics(opts.metricsAddr, []string{cfg.Device}, []*recorder.Recorder{r})
+		if err != nil {
+			r.Stop()
+			return fmt.Errorf("metrics server: %w", err)
+		}
+		defer ms.Close()
+	}
+	info := r.StreamInfo()
+	ring := newReplayRing(d, info.SampleRate, info.Channels)
+	stream := r.Stream()
+	go feedReplay(stream, ring)
+
+	save := func() {
+		path, err := saveReplay(out, info, ring.snapshot(), cfg.Overwrite)
+		if err != nil {
+			slog.Error("Saving replay failed", "err", err)
+			return
+		}
+		slog.Info("Saved replay", "path", path)
+	}
+	go adjustVolume(os.Stdin, keyActions{'s': save}, r)
+	if !opts.quiet {
+		go showLevels(ctx, r, os.Stderr)
+	}
+	if opts.stats > 0 {
+		go showStats(ctx, r, os.Stderr, opts.stats)
+	}
+	slog.Info("Keeping a replay buffer; press s to save it", "length", d)
+	if err := r.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// feedReplay copies the samples of stream into ring until it ends.
+func feedReplay(stream io.ReadCloser, ring *replayRing) {
+	defer stream.Close()
+	buf := make([]byte, 64<<10)
+	var samples []int16
+	carry := 0 // Odd byte left from the previous read.
+	for {
+		n, err := stream.Read(buf[carry:])
+		n += carry
+		samples = samples[:0]
+		for i := 0; i+1 < n; i += 2 {
+			samples = append(samples, int16(binary.LittleEndian.Uint16(buf[i:])))
+		}
+		ring.write(samples)
+		if carry = n % 2; carry == 1 {
+			buf[0] = buf[n-1]
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// saveReplay writes samples to a new WAV file named after out with the
+// current time inserted before the extension, and returns its path.
+func saveReplay(out string, info recorder.StreamInfo, samples []int16, overwrite bool) (string, error) {
+	ext := filepath.Ext(out)
+	path := strings.TrimSuffix(out, ext) + time.Now().Format("-20060102-150405") + ext
+	f, err := recorder.CreateOutput(path, overwrite)
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, 0, 2*len(samples))
+	for _, s := range samples {
+		data = binary.LittleEndian.AppendUint16(data, uint16(s))
+	}
+	if err := recorder.WriteWav(f, info, data); err != nil {
+		f.Close()
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return path, f.Close()
+}
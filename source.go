@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"audio-grab/recorder"
+)
+
+// defaultSourceRate is the sample rate of generated sources when -sample-rate
+// is not given.
+const defaultSourceRate = 48000
+
+// sourceBackend returns the backend generating the signal described by spec,
+// "tone:FREQ" or "sweep:LOW:HIGH" with frequencies in Hz. A sweep spans the
+// whole recording.
+func sourceBackend(spec string, channels int, rate float64, length time.Duration) (recorder.AudioBackend, error) {
+	if rate == 0 {
+		rate = defaultSourceRate
+	}
+	kind, args, _ := strings.Cut(spec, ":")
+	var freqs []float64
+	for _, s := range strings.Split(args, ":") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f <= 0 || f >= rate/2 {
+			return nil, fmt.Errorf("invalid source %q: frequencies must be between 0 and %.0f Hz", spec, rate/2)
+		}
+		freqs = append(freqs, f)
+	}
+	switch {
+	case kind == "tone" && len(freqs) == 1:
+		return recorder.NewToneBackend(channels, rate, freqs[0]), nil
+	case kind == "sweep" && len(freqs) == 2:
+		return recorder.NewSweepBackend(channels, rate, freqs[0], freqs[1], length), nil
+	default:
+		return nil, fmt.Errorf("invalid source %q: want tone:FREQ or sweep:LOW:HIGH", spec)
+	}
+}
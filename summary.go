@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"audio-grab/recorder"
+)
+
+// writeSummary writes each summary as a line of JSON to stderr if requested
+// and to the summary file, if any.
+func writeSummary(opts options, summaries ...recorder.RecordingSummary) error {
+	if !opts.summary && opts.summaryFile == "" {
+		return nil
+	}
+	var ws []io.Writer
+	if opts.summary {
+		ws = append(ws, os.Stderr)
+	}
+	if opts.summaryFile != "" {
+		f, err := os.Create(opts.summaryFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		ws = append(ws, f)
+	}
+	enc := json.NewEncoder(io.MultiWriter(ws...))
+	for _, s := range summaries {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSidecar writes s as indented JSON next to its output file, named
+// after it with the extension replaced by .json. Like the output, an
+// existing file is only replaced if overwrite is set.
+func writeSidecar(s recorder.RecordingSummary, overwrite bool) error {
+	path := strings.TrimSuffix(s.Output, filepath.Ext(s.Output)) + ".json"
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := recorder.CreateOutput(path, overwrite)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
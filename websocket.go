@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"audio-grab/recorder"
+)
+
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	wsOpText   = 0x1
+	wsOpBinary = 0x2
+	wsOpClose  = 0x8
+	wsOpPing   = 0x9
+	wsOpPong   = 0xA
+
+	// wsWriteTimeout bounds how long a stalled client can hold its handler,
+	// and with it wsServer.Close.
+	wsWriteTimeout = 5 * time.Second
+	wsReadSize     = 64 << 10
+)
+
+// wsHeader is sent as a text message before the first binary PCM message.
+type wsHeader struct {
+	SampleRate    int    `json:"sampleRate"`
+	Channels      int    `json:"channels"`
+	BitsPerSample int    `json:"bitsPerSample"`
+	Encoding      string `json:"encoding"` // "pcm", "float", "alaw", "ulaw" or "adpcm".
+	ByteOrder     string `json:"byteOrder"`
+}
+
+// wsServer serves the live audio of a Recorder to WebSocket clients. Each
+// client gets its own Recorder.Stream, so clients never take buffers from the
+// file or from each other.
+type wsServer struct {
+	r   *recorder.Recorder
+	srv *http.Server
+
+	mu     sync.Mutex // Orders wg.Add in handle before wg.Wait in Close.
+	closed bool
+	wg     sync.WaitGroup // Hijacked connections, which srv no longer tracks.
+}
+
+func serveWebSocket(addr string, r *recorder.Recorder) (*wsServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &wsServer{r: r}
+	s.srv = &http.Server{Handler: http.HandlerFunc(s.handle)}
+	go s.srv.Serve(ln)
+	slog.Info("Streaming over WebSocket", "url", "ws://"+ln.Addr().String()+"/")
+	return s, nil
+}
+
+// Close stops accepting clients and waits for connected ones to finish. It
+// is meant to be called once the Recorder is stopped, which ends every
+// client's stream.
+func (s *wsServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	err := s.srv.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *wsServer) handle(w http.ResponseWriter, req *http.Request) {
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be upgraded", http.StatusInternalServerError)
+		return
+	}
+	// Counted before the connection is taken over, so that Close waits for it.
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+
+	stream := s.r.Stream()
+	defer stream.Close()
+
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	// Frames are written both here and, for pongs, by the reader goroutine.
+	var mu sync.Mutex
+	send := func(opcode byte, payload []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return writeWSFrame(conn, opcode, payload)
+	}
+
+	// The client only ever sends control frames; once it closes or goes
+	// away, closing the stream ends the send loop below.
+	go func() {
+		defer stream.Close()
+		readWSFrames(rw.Reader, func(opcode byte, payload []byte) bool {
+			switch opcode {
+			case wsOpClose:
+				send(wsOpClose, nil)
+				return false
+			case wsOpPing:
+				send(wsOpPong, payload)
+			}
+			return true
+		})
+	}()
+
+	info := s.r.StreamInfo()
+	hdr := wsHeader{
+		SampleRate:    info.SampleRate,
+		Channels:      info.Channels,
+		BitsPerSample: info.BitsPerSample,
+		Encoding:      "pcm",
+		ByteOrder:     "little",
+	}
+	if info.Float {
+		hdr.Encoding = "float"
+	}
+	if info.Codec != "" {
+		hdr.Encoding = string(info.Codec)
+	}
+	if info.BigEndian {
+		hdr.ByteOrder = "big"
+	}
+	b, _ := json.Marshal(hdr)
+	if err := send(wsOpText, b); err != nil {
+		return
+	}
+
+	buf := make([]byte, wsReadSize)
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 {
+			if send(wsOpBinary, buf[:n]) != nil {
+				return
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			send(wsOpClose, nil)
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeWSFrame writes payload as a single unmasked frame, as servers send
+// them.
+func writeWSFrame(w io.Writer, opcode byte, payload []byte) error {
+	hdr := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		hdr = append(hdr, byte(n))
+	case n <= 0xFFFF:
+		hdr = append(hdr, 126)
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr = append(hdr, 127)
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readWSFrames reads masked client frames and passes each to handle until it
+// returns false or the connection fails.
+func readWSFrames(br *bufio.Reader, handle func(opcode byte, payload []byte) bool) {
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(br, hdr[:2]); err != nil {
+			return
+		}
+		opcode := hdr[0] & 0x0F
+		masked := hdr[1]&0x80 != 0
+		n := uint64(hdr[1] & 0x7F)
+		switch n {
+		case 126:
+			if _, err := io.ReadFull(br, hdr[:2]); err != nil {
+				return
+			}
+			n = uint64(binary.BigEndian.Uint16(hdr[:2]))
+		case 127:
+			if _, err := io.ReadFull(br, hdr[:8]); err != nil {
+				return
+			}
+			n = binary.BigEndian.Uint64(hdr[:8])
+		}
+		var mask [4]byte
+		if masked {
+			if _, err := io.ReadFull(br, mask[:]); err != nil {
+				return
+			}
+		}
+		if n > wsReadSize {
+			return
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+		if !handle(opcode, payload) {
+			return
+		}
+	}
+}